@@ -0,0 +1,425 @@
+package gosession
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+var (
+	// APIKeyPrefixDefault default prefix of api key, so it can be recognized such in secret scan
+	APIKeyPrefixDefault = "gsk"
+
+	// APIKeyTouchInterval last used time of api key write at most once in this second
+	APIKeyTouchInterval int64 = 60
+)
+
+// APIKeyManage long-lived personal api key manage, key not expire until revoke,
+// only hash of key is stored, check it return the same user shape as TokenManage
+type APIKeyManage interface {
+	CreateAPIKey(userId string, name string, scopes []string) (key string, apiKey *APIKey, err error) // Create api key, the key only return this time, save it
+	CheckAPIKey(key string) (user *User, exist bool, err error)                                       // Check the api key, but not refresh user info cache
+	CheckAPIKeyOrUpdateUser(key string, userInfoValidTimes int64) (user *User, exist bool, err error) // Check the api key, user info load like CheckTokenOrUpdateUser
+	ListAPIKey(userId string) ([]*APIKey, error)                                                      // List all api key of one user, order by create time
+	RevokeAPIKey(userId string, keyId string) error                                                   // Revoke one api key of user
+	RevokeUserAPIKey(userId string) error                                                             // Revoke all api key of user
+	ConfigAPIKeyPrefix(prefix string) APIKeyManage                                                    // Config chain, prefix of new api key
+}
+
+// APIKey api key info, not contain the key itself
+type APIKey struct {
+	Id           string   `json:"id"`                       // unique mark, part of key
+	UserId       string   `json:"user_id"`                  // whose key
+	Name         string   `json:"name"`                     // name user give
+	Scopes       []string `json:"scopes,omitempty"`         // what key can do, empty means full power of user
+	Hint         string   `json:"hint"`                     // last chars of key, help user recognize it
+	CreateTime   int64    `json:"create_time"`              // unix second when create
+	LastUsedTime int64    `json:"last_used_time,omitempty"` // unix second when last check, 0 never, it delays at most APIKeyTouchInterval
+}
+
+// NewRedisAPIKeyManage new api key manage share the redis and user info cache of the token manage
+func NewRedisAPIKeyManage(tokenManage TokenManage) (APIKeyManage, error) {
+	s, ok := tokenManage.(*RedisSession)
+	if !ok || s == nil {
+		return nil, errors.New("token manage is not redis session")
+	}
+
+	return s, nil
+}
+
+// ConfigAPIKeyPrefix config by chain
+func (s *RedisSession) ConfigAPIKeyPrefix(prefix string) APIKeyManage {
+	s.apiKeyPrefix = strings.Replace(prefix, "_", "-", -1)
+	return s
+}
+
+// CreateAPIKey Create api key of user with name, empty scopes means full power of user
+func (s *RedisSession) CreateAPIKey(userId string, name string, scopes []string) (key string, apiKey *APIKey, err error) {
+	if userId == "" {
+		err = errors.New("user id empty")
+		return
+	}
+
+	if name == "" {
+		err = errors.New("api key name empty")
+		return
+	}
+
+	for _, scope := range scopes {
+		if scope == "" {
+			err = errors.New("scope empty")
+			return
+		}
+	}
+
+	secret := make([]byte, 32)
+	_, err = rand.Read(secret)
+	if err != nil {
+		return
+	}
+
+	prefix := s.apiKeyPrefix
+	if prefix == "" {
+		prefix = APIKeyPrefixDefault
+	}
+
+	apiKey = &APIKey{
+		Id:         GetGUID(),
+		UserId:     userId,
+		Name:       name,
+		Scopes:     scopes,
+		CreateTime: s.now().Unix(),
+	}
+	key = fmt.Sprintf("%s_%s_%s", prefix, apiKey.Id, hex.EncodeToString(secret))
+	apiKey.Hint = key[len(key)-4:]
+
+	raw, err := json.Marshal(apiKey)
+	if err != nil {
+		return "", nil, err
+	}
+
+	conn := s.pool.Get()
+	if conn.Err() != nil {
+		err = conn.Err()
+		return "", nil, err
+	}
+
+	defer func(conn redis.Conn) {
+		err := conn.Close()
+		if err != nil {
+		}
+	}(conn)
+
+	keyHash := hashAPIKey(key)
+
+	err = conn.Send("MULTI")
+	if err != nil {
+		return "", nil, err
+	}
+
+	err = conn.Send("SET", s.apiKeyKey(keyHash), raw)
+	if err != nil {
+		return "", nil, err
+	}
+
+	err = conn.Send("HSET", s.userAPIKeyMapKey(userId), apiKey.Id, keyHash)
+	if err != nil {
+		return "", nil, err
+	}
+
+	_, err = conn.Do("EXEC")
+	if err != nil {
+		return "", nil, err
+	}
+
+	return key, apiKey, nil
+}
+
+// CheckAPIKey Check the api key, but not refresh user info cache
+func (s *RedisSession) CheckAPIKey(key string) (user *User, exist bool, err error) {
+	return s.CheckAPIKeyOrUpdateUser(key, -1)
+}
+
+// CheckAPIKeyOrUpdateUser Check the api key, the user Token is the key, and TokenRemainLiveTime is -1 means never expire
+func (s *RedisSession) CheckAPIKeyOrUpdateUser(key string, userInfoValidTimes int64) (user *User, exist bool, err error) {
+	if key == "" {
+		err = errors.New("api key empty")
+		return
+	}
+
+	keyId, ok := parseAPIKeyId(key)
+	if !ok {
+		err = errors.New("api key wrong")
+		return
+	}
+
+	value, _, exist, err := s.get(s.apiKeyKey(hashAPIKey(key)))
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !exist {
+		return nil, false, nil
+	}
+
+	apiKey := new(APIKey)
+	err = json.Unmarshal(value, apiKey)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if apiKey.Id != keyId || apiKey.UserId == "" {
+		return nil, false, errors.New("api key not match")
+	}
+
+	_, banned, err := s.GetBan(apiKey.UserId)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if banned {
+		return nil, false, nil
+	}
+
+	s.touchAPIKey(apiKey)
+
+	if s.getUserFunc == nil || userInfoValidTimes < 0 {
+		user = new(User)
+		user.Id = apiKey.UserId
+	} else {
+		user, exist, err = s.loadUser(apiKey.UserId, s.hashUserKey(apiKey.UserId), userInfoValidTimes)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if !exist {
+			return nil, false, nil
+		}
+	}
+
+	user.Token = key
+	user.TokenRemainLiveTime = -1
+	user.TokenExpireTime = 0
+	user.Scopes = apiKey.Scopes
+	return user, true, nil
+}
+
+// ListAPIKey List all api key of user, order by create time
+func (s *RedisSession) ListAPIKey(userId string) ([]*APIKey, error) {
+	if userId == "" {
+		return nil, errors.New("user id empty")
+	}
+
+	conn := s.pool.Get()
+	if conn.Err() != nil {
+		return nil, conn.Err()
+	}
+
+	defer func(conn redis.Conn) {
+		err := conn.Close()
+		if err != nil {
+		}
+	}(conn)
+
+	keyHashes, err := redis.StringMap(conn.Do("HGETALL", s.userAPIKeyMapKey(userId)))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keyHashes) == 0 {
+		return []*APIKey{}, nil
+	}
+
+	usedTimes, err := redis.StringMap(conn.Do("HGETALL", s.userAPIKeyUsedKey(userId)))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*APIKey, 0, len(keyHashes))
+	for id, keyHash := range keyHashes {
+		value, err := redis.Bytes(conn.Do("GET", s.apiKeyKey(keyHash)))
+		if err == redis.ErrNil {
+			// key lost, clean the map
+			_, err = conn.Do("HDEL", s.userAPIKeyMapKey(userId), id)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		apiKey := new(APIKey)
+		err = json.Unmarshal(value, apiKey)
+		if err != nil {
+			return nil, err
+		}
+
+		apiKey.LastUsedTime = SI(usedTimes[id])
+		result = append(result, apiKey)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].CreateTime == result[j].CreateTime {
+			return result[i].Id < result[j].Id
+		}
+		return result[i].CreateTime < result[j].CreateTime
+	})
+
+	return result, nil
+}
+
+// RevokeAPIKey Revoke one api key of user, not exist not error
+func (s *RedisSession) RevokeAPIKey(userId string, keyId string) (err error) {
+	if userId == "" {
+		err = errors.New("user id empty")
+		return
+	}
+
+	if keyId == "" {
+		err = errors.New("api key id empty")
+		return
+	}
+
+	return s.revokeAPIKey(userId, []string{keyId})
+}
+
+// RevokeUserAPIKey Revoke all api key of user
+func (s *RedisSession) RevokeUserAPIKey(userId string) (err error) {
+	if userId == "" {
+		err = errors.New("user id empty")
+		return
+	}
+
+	apiKeys, err := s.ListAPIKey(userId)
+	if err != nil {
+		return err
+	}
+
+	if len(apiKeys) == 0 {
+		return nil
+	}
+
+	keyIds := make([]string, 0, len(apiKeys))
+	for _, apiKey := range apiKeys {
+		keyIds = append(keyIds, apiKey.Id)
+	}
+
+	return s.revokeAPIKey(userId, keyIds)
+}
+
+// delete api key and its index
+func (s *RedisSession) revokeAPIKey(userId string, keyIds []string) (err error) {
+	conn := s.pool.Get()
+	if conn.Err() != nil {
+		err = conn.Err()
+		return
+	}
+
+	defer func(conn redis.Conn) {
+		err := conn.Close()
+		if err != nil {
+		}
+	}(conn)
+
+	mapKey := s.userAPIKeyMapKey(userId)
+	for _, keyId := range keyIds {
+		keyHash, err := redis.String(conn.Do("HGET", mapKey, keyId))
+		if err == redis.ErrNil {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		err = conn.Send("MULTI")
+		if err != nil {
+			return err
+		}
+
+		err = conn.Send("DEL", s.apiKeyKey(keyHash))
+		if err != nil {
+			return err
+		}
+
+		err = conn.Send("HDEL", mapKey, keyId)
+		if err != nil {
+			return err
+		}
+
+		err = conn.Send("HDEL", s.userAPIKeyUsedKey(userId), keyId)
+		if err != nil {
+			return err
+		}
+
+		_, err = conn.Do("EXEC")
+		if err != nil {
+			return err
+		}
+
+		s.apiKeyTouched.Delete(keyId)
+	}
+
+	return nil
+}
+
+// record last used time, write redis at most once in APIKeyTouchInterval by this process
+func (s *RedisSession) touchAPIKey(apiKey *APIKey) {
+	now := s.now().Unix()
+	if last, ok := s.apiKeyTouched.Load(apiKey.Id); ok && now-last.(int64) < APIKeyTouchInterval {
+		return
+	}
+	s.apiKeyTouched.Store(apiKey.Id, now)
+
+	conn := s.pool.Get()
+	if conn.Err() != nil {
+		return
+	}
+
+	defer func(conn redis.Conn) {
+		err := conn.Close()
+		if err != nil {
+		}
+	}(conn)
+
+	_, err := conn.Do("HSET", s.userAPIKeyUsedKey(apiKey.UserId), apiKey.Id, now)
+	if err != nil {
+	}
+}
+
+// key is prefix_id_secret, return the id
+func parseAPIKeyId(key string) (keyId string, ok bool) {
+	temp := strings.Split(key, "_")
+	if len(temp) != 3 || temp[0] == "" || temp[1] == "" || len(temp[2]) != 64 {
+		return "", false
+	}
+
+	return temp[1], true
+}
+
+// only the hash of api key store in redis
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// gen apiKeyKey, as a key in redis, it's value will be api key info
+func (s *RedisSession) apiKeyKey(keyHash string) string {
+	return fmt.Sprintf("%s-apikey_%s", s.tokenKey, keyHash)
+}
+
+// hash map key which store all api key id of user, value is the key hash
+func (s *RedisSession) userAPIKeyMapKey(userId string) string {
+	return fmt.Sprintf("%s-apikey-user_%s", s.tokenKey, userId)
+}
+
+// hash map key which store last used time of api key of user
+func (s *RedisSession) userAPIKeyUsedKey(userId string) string {
+	return fmt.Sprintf("%s-apikey-used_%s", s.tokenKey, userId)
+}
@@ -0,0 +1,107 @@
+package gosession
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseAPIKeyId(t *testing.T) {
+	secret := strings.Repeat("a", 64)
+	cases := []struct {
+		key  string
+		id   string
+		want bool
+	}{
+		{"gsk_abc_" + secret, "abc", true},
+		{"my-app_abc_" + secret, "abc", true},
+		{"gsk_abc_" + secret[1:], "", false},
+		{"gsk__" + secret, "", false},
+		{"_abc_" + secret, "", false},
+		{"1_" + strings.Repeat("b", 32), "", false},
+		{"", "", false},
+	}
+
+	for _, c := range cases {
+		id, ok := parseAPIKeyId(c.key)
+		if ok != c.want || id != c.id {
+			t.Fatalf("parseAPIKeyId(%q) = %q, %v, want %q, %v", c.key, id, ok, c.id, c.want)
+		}
+	}
+
+	if hashAPIKey("gsk_abc_"+secret) == hashAPIKey("gsk_abd_"+secret) {
+		t.Fatal("hash of different key should not equal")
+	}
+}
+
+func TestAPIKeyRoundTrip(t *testing.T) {
+	s := newTestRedisSession(t)
+	m, err := NewRedisAPIKeyManage(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, apiKey, err := m.CreateAPIKey("1", "ci", []string{"orders:read"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(key, APIKeyPrefixDefault+"_"+apiKey.Id+"_") || !strings.HasSuffix(key, apiKey.Hint) {
+		t.Fatalf("key %q not match info %+v", key, apiKey)
+	}
+
+	user, exist, err := m.CheckAPIKey(key)
+	if err != nil || !exist {
+		t.Fatalf("check api key: %v %v", exist, err)
+	}
+
+	if user.Id != "1" || user.Token != key || user.TokenRemainLiveTime != -1 || !HasScopes(user.Scopes, "orders:read") || HasScopes(user.Scopes, "orders:write") {
+		t.Fatalf("user wrong: %+v", user)
+	}
+
+	// wrong secret with right id
+	if _, exist, _ = m.CheckAPIKey(key[:len(key)-1] + "x"); exist {
+		t.Fatal("wrong secret should not pass")
+	}
+
+	other, _, err := m.CreateAPIKey("1", "deploy", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := m.ListAPIKey("1")
+	if err != nil || len(keys) != 2 {
+		t.Fatalf("list api key wrong: %+v %v", keys, err)
+	}
+
+	// the checked one has last used time
+	for _, k := range keys {
+		if used := k.LastUsedTime != 0; used != (k.Id == apiKey.Id) {
+			t.Fatalf("last used time wrong: %+v", k)
+		}
+	}
+
+	if err = m.RevokeAPIKey("1", apiKey.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, exist, err = m.CheckAPIKey(key); err != nil || exist {
+		t.Fatalf("revoked key should not pass: %v %v", exist, err)
+	}
+
+	if _, exist, err = m.CheckAPIKey(other); err != nil || !exist {
+		t.Fatalf("other key should pass: %v %v", exist, err)
+	}
+
+	if err = m.RevokeUserAPIKey("1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, exist, err = m.CheckAPIKey(other); err != nil || exist {
+		t.Fatalf("revoke all should revoke other key: %v %v", exist, err)
+	}
+
+	keys, err = m.ListAPIKey("1")
+	if err != nil || len(keys) != 0 {
+		t.Fatalf("list after revoke all: %+v %v", keys, err)
+	}
+}
@@ -0,0 +1,175 @@
+package gosession
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+var (
+	// ErrAuthLevelTooLow token authentication assurance level lower than required, such mfa not passed
+	ErrAuthLevelTooLow = errors.New("auth level too low")
+
+	// ErrReauthRequired user not authenticated recently, need step-up authentication again
+	ErrReauthRequired = errors.New("reauth required")
+)
+
+// AuthLevel authentication assurance level of token
+type AuthLevel string
+
+const (
+	AuthLevelPendingMFA AuthLevel = "pending_mfa" // password passed, wait for second factor
+	AuthLevelFull       AuthLevel = "full"        // all factor passed
+)
+
+// higher rank more trust, unknown level rank 0
+func (l AuthLevel) rank() int {
+	switch l {
+	case AuthLevelPendingMFA:
+		return 1
+	case AuthLevelFull:
+		return 2
+	}
+	return 0
+}
+
+// old token not has level, it is full
+func (r *tokenRecord) authLevel() AuthLevel {
+	if r.AuthLevel == "" {
+		return AuthLevelFull
+	}
+	return r.AuthLevel
+}
+
+// full token not elevate, it authenticated when create
+func (r *tokenRecord) authTime() int64 {
+	if r.AuthTime == 0 && r.authLevel() == AuthLevelFull {
+		return r.CreateTime
+	}
+	return r.AuthTime
+}
+
+// SetTokenWithLevel Set token at authentication assurance level, expire after some second,
+// such AuthLevelPendingMFA after password, then ElevateToken to AuthLevelFull after totp,
+// token not full only pass RequireAuthLevel, CheckToken treat it as not exist
+func (s *RedisSession) SetTokenWithLevel(userId string, tokenValidTimes int64, level AuthLevel) (token string, err error) {
+	if level.rank() == 0 {
+		return "", fmt.Errorf("auth level wrong: %s", level)
+	}
+
+	record := &tokenRecord{AuthLevel: level}
+	if level == AuthLevelFull {
+		record.AuthTime = s.now().Unix()
+	}
+
+	return s.setToken(userId, tokenValidTimes, record)
+}
+
+// ElevateToken upgrade the token to level in place, the token not change, also use it when step-up authentication passed
+// which refresh the AuthTime, level lower than now not allow, in single mode other token evicted when it become full
+func (s *RedisSession) ElevateToken(token string, level AuthLevel) (err error) {
+	if token == "" {
+		err = errors.New("token empty")
+		return
+	}
+
+	temp := strings.Split(token, "_")
+	if len(temp) < 2 || temp[0] == "" {
+		err = errors.New("token wrong")
+		return
+	}
+
+	if level.rank() == 0 {
+		return fmt.Errorf("auth level wrong: %s", level)
+	}
+
+	userId := temp[0]
+
+	var (
+		ttl    int64
+		toFull bool
+	)
+	exist, err := s.watchTokenRecord(userId, token, func(conn redis.Conn, record *tokenRecord, oldTTL int64) error {
+		if level.rank() < record.authLevel().rank() {
+			return fmt.Errorf("auth level can not lower from %s to %s", record.authLevel(), level)
+		}
+
+		toFull = level == AuthLevelFull && record.authLevel() != AuthLevelFull
+
+		record.AuthLevel = level
+		record.AuthTime = s.now().Unix()
+		raw, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+
+		ttl = oldTTL
+		return conn.Send("SETEX", s.hashTokenKey(token), oldTTL, raw)
+	})
+	if err != nil {
+		return err
+	}
+
+	if !exist {
+		return ErrTokenExpired
+	}
+
+	// single mode evict deferred from SetTokenWithLevel
+	if toFull && s.isSingleMode {
+		err = s.deleteUserTokenExcept(userId, token, EventEvict, "single mode")
+		if err != nil {
+			return err
+		}
+	}
+
+	s.emit(EventElevate, userId, token, ttl, string(level))
+	return s.invalidateLocalCache([]string{token}, nil)
+}
+
+// RequireAuthLevel Check the token like CheckToken, it must at least the level or return ErrAuthLevelTooLow,
+// and when maxAuthAge > 0, user must authenticated in maxAuthAge second or return ErrReauthRequired.
+// CheckToken and others treat token lower than AuthLevelFull as not exist, only this accept it,
+// such RequireAuthLevel(token, AuthLevelPendingMFA, 0) at the endpoint verify second factor
+func (s *RedisSession) RequireAuthLevel(token string, level AuthLevel, maxAuthAge int64) (user *User, exist bool, err error) {
+	if level.rank() == 0 {
+		return nil, false, fmt.Errorf("auth level wrong: %s", level)
+	}
+
+	// local cache only has full token, check it in redis
+	user, exist, err = s.checkTokenOrUpdateUser(token, -1, AuthLevelPendingMFA)
+	if err != nil || !exist {
+		return user, exist, err
+	}
+
+	if !hasAuthLevel(user, level, maxAuthAge, s.now().Unix()) {
+		if user.AuthLevel.rank() < level.rank() {
+			return nil, true, ErrAuthLevelTooLow
+		}
+		return nil, true, ErrReauthRequired
+	}
+
+	return user, true, nil
+}
+
+// HasAuthLevel user of token at least the level, and authenticated in maxAuthAge second when maxAuthAge > 0,
+// age count by real time, RequireAuthLevel count it by clock of session
+func HasAuthLevel(user *User, level AuthLevel, maxAuthAge int64) bool {
+	return hasAuthLevel(user, level, maxAuthAge, time.Now().Unix())
+}
+
+// same as HasAuthLevel, auth age count at now, so session clock work
+func hasAuthLevel(user *User, level AuthLevel, maxAuthAge int64, now int64) bool {
+	if user == nil || user.AuthLevel.rank() < level.rank() {
+		return false
+	}
+
+	if maxAuthAge > 0 && now-user.AuthTime > maxAuthAge {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,122 @@
+package gosession
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHasAuthLevel(t *testing.T) {
+	now := time.Now().Unix()
+
+	// old token has no level, it is full and authenticated when create
+	old := &tokenRecord{CreateTime: now - 100}
+	if old.authLevel() != AuthLevelFull || old.authTime() != now-100 {
+		t.Fatalf("old record level %s time %d", old.authLevel(), old.authTime())
+	}
+
+	pending := &tokenRecord{CreateTime: now, AuthLevel: AuthLevelPendingMFA}
+	if pending.authTime() != 0 {
+		t.Fatalf("pending record should not authenticated, got %d", pending.authTime())
+	}
+
+	user := &User{AuthLevel: AuthLevelPendingMFA}
+	if HasAuthLevel(user, AuthLevelFull, 0) {
+		t.Fatal("pending mfa should not be full")
+	}
+
+	if !HasAuthLevel(user, AuthLevelPendingMFA, 0) {
+		t.Fatal("pending mfa should be pending mfa")
+	}
+
+	user = &User{AuthLevel: AuthLevelFull, AuthTime: now - 600}
+	if !HasAuthLevel(user, AuthLevelPendingMFA, 0) {
+		t.Fatal("full should higher than pending mfa")
+	}
+
+	if HasAuthLevel(user, AuthLevelFull, 300) {
+		t.Fatal("authenticated too long ago should need step-up")
+	}
+
+	if !HasAuthLevel(user, AuthLevelFull, 900) {
+		t.Fatal("authenticated recently should pass")
+	}
+
+	if HasAuthLevel(nil, AuthLevelPendingMFA, 0) {
+		t.Fatal("nil user should not pass")
+	}
+
+	// age count from the clock of session, not real time
+	if hasAuthLevel(user, AuthLevelFull, 900, now+600) {
+		t.Fatal("auth age should count from given now")
+	}
+}
+
+func TestPendingMFANotLogIn(t *testing.T) {
+	s := newTestRedisSession(t)
+	s.ConfigGetUserInfoFunc(func(id string) (*User, error) {
+		return &User{Id: id}, nil
+	})
+
+	token, err := s.SetTokenWithLevel("1", 100, AuthLevelPendingMFA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, exist, err := s.CheckToken(token); err != nil || exist {
+		t.Fatalf("check pending mfa token should fail: %v %v", exist, err)
+	}
+
+	if _, exist, err := s.CheckTokenOrUpdateUser(token, 100); err != nil || exist {
+		t.Fatalf("check pending mfa token with user should fail: %v %v", exist, err)
+	}
+
+	// only the second factor endpoint accept it
+	user, exist, err := s.RequireAuthLevel(token, AuthLevelPendingMFA, 0)
+	if err != nil || !exist || user.AuthLevel != AuthLevelPendingMFA {
+		t.Fatalf("require pending mfa: %+v %v %v", user, exist, err)
+	}
+
+	if _, _, err = s.RequireAuthLevel(token, AuthLevelFull, 0); err != ErrAuthLevelTooLow {
+		t.Fatalf("require full of pending mfa token: %v", err)
+	}
+
+	if err = s.ElevateToken(token, AuthLevelFull); err != nil {
+		t.Fatal(err)
+	}
+
+	if user, exist, err = s.CheckToken(token); err != nil || !exist || user.AuthLevel != AuthLevelFull {
+		t.Fatalf("check elevated token: %+v %v %v", user, exist, err)
+	}
+}
+
+func TestSingleModeEvictWhenElevate(t *testing.T) {
+	s := newTestRedisSession(t)
+	s.SetSingleMode()
+
+	full, err := s.SetToken("1", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// password only login not kick the full one out
+	pending, err := s.SetTokenWithLevel("1", 100, AuthLevelPendingMFA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, exist, err := s.CheckToken(full); err != nil || !exist {
+		t.Fatalf("full token should live before mfa pass: %v %v", exist, err)
+	}
+
+	if err = s.ElevateToken(pending, AuthLevelFull); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, exist, err := s.CheckToken(full); err != nil || exist {
+		t.Fatalf("full token should be evicted after mfa pass: %v %v", exist, err)
+	}
+
+	if _, exist, err := s.CheckToken(pending); err != nil || !exist {
+		t.Fatalf("elevated token should live: %v %v", exist, err)
+	}
+}
@@ -0,0 +1,151 @@
+package gosession
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock where session get now, inject a FakeClock in test so expiry not need real sleep
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SystemClock the real clock, default of all session
+var SystemClock Clock = systemClock{}
+
+// FakeClock clock only move when Advance or Set, safe for concurrent use
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFakeClock new a fake clock start at now
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now current time of fake clock
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance move the clock forward d
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+// Set move the clock to t
+func (c *FakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	c.now = t
+	c.mu.Unlock()
+}
+
+// now of clock, nil means SystemClock
+func clockNow(c Clock) time.Time {
+	if c == nil {
+		return time.Now()
+	}
+	return c.Now()
+}
+
+// ConfigClock config by chain, expire time store in hash such token map and ban, and lazy cleanup of it follow the clock,
+// so do auth age of RequireAuthLevel, event time, local cache staleness and janitor stats,
+// but key ttl is counted by redis itself, so fake clock can not make redis key expire,
+// and HasAuthLevel has no session, it count by real time
+func (s *RedisSession) ConfigClock(clock Clock) TokenManage {
+	s.clock = clock
+	s.events.clock = clock
+	return s
+}
+
+func (s *RedisSession) now() time.Time {
+	return clockNow(s.clock)
+}
+
+// ConfigClock config by chain, token and user expire follow the clock, event time too,
+// shipped store such MemoryStore and RedisStore follow it too, other store config its own clock
+func (s *StoreSession) ConfigClock(clock Clock) TokenManage {
+	s.clock = clock
+	s.events.clock = clock
+	if c, ok := s.store.(clockStore); ok {
+		c.setClock(clock)
+	}
+	return s
+}
+
+// store can follow clock of StoreSession
+type clockStore interface {
+	setClock(clock Clock)
+}
+
+func (s *StoreSession) now() time.Time {
+	return clockNow(s.clock)
+}
+
+// ConfigClock config by chain, expired token and user cleanup lazy by the clock
+func (m *MemoryStore) ConfigClock(clock Clock) *MemoryStore {
+	m.setClock(clock)
+	return m
+}
+
+func (m *MemoryStore) setClock(clock Clock) {
+	m.mu.Lock()
+	m.clock = clock
+	m.mu.Unlock()
+}
+
+// lock hold by caller or not both ok, clock only change by ConfigClock before use
+func (m *MemoryStore) now() time.Time {
+	return clockNow(m.clock)
+}
+
+// ConfigClock config by chain, ttl of key count from the clock and expired token in list cleanup by it,
+// key still expire by redis itself
+func (r *RedisStore) ConfigClock(clock Clock) *RedisStore {
+	r.setClock(clock)
+	return r
+}
+
+// clock only change by config before use
+func (r *RedisStore) setClock(clock Clock) {
+	r.clock = clock
+}
+
+func (r *RedisStore) now() time.Time {
+	return clockNow(r.clock)
+}
+
+// ConfigClock config by chain, token and user expire follow the clock, event time too
+func (s *FileSession) ConfigClock(clock Clock) TokenManage {
+	s.mu.Lock()
+	s.clock = clock
+	s.mu.Unlock()
+	s.events.clock = clock
+	return s
+}
+
+func (s *FileSession) now() time.Time {
+	return clockNow(s.clock)
+}
+
+// ConfigClock config by chain, expires_at column write and compare by the clock, event time too
+func (s *SQLSession) ConfigClock(clock Clock) TokenManage {
+	s.clock = clock
+	s.events.clock = clock
+	return s
+}
+
+func (s *SQLSession) now() time.Time {
+	return clockNow(s.clock)
+}
@@ -0,0 +1,85 @@
+package gosession
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Unix(1000, 0)
+	clock := NewFakeClock(start)
+	clock.Advance(10 * time.Second)
+	if clock.Now().Unix() != 1010 {
+		t.Fatalf("advance wrong: %v", clock.Now())
+	}
+
+	clock.Set(start)
+	if !clock.Now().Equal(start) {
+		t.Fatalf("set wrong: %v", clock.Now())
+	}
+
+	if clockNow(nil).IsZero() {
+		t.Fatal("nil clock should be system clock")
+	}
+}
+
+func TestFileSessionClockSweep(t *testing.T) {
+	tm, err := NewFileSession(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock := NewFakeClock(time.Now())
+	s := tm.(*FileSession)
+	s.ConfigClock(clock)
+	defer s.Close()
+
+	token, _ := s.SetToken("1", 100)
+	clock.Advance(101 * time.Second)
+	if _, exist, _ := s.CheckToken(token); exist {
+		t.Fatal("token should expire by fake clock")
+	}
+
+	s.mu.Lock()
+	s.sweep(s.now().Unix())
+	s.mu.Unlock()
+	if len(s.tokens) != 0 {
+		t.Fatal("expired token should be swept by fake clock")
+	}
+}
+
+func TestClockDriveEventAndLocalCache(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	s := newRedisSession(nil, tokenKeyDefault, userKeyDefault, expireTimeDefault)
+	s.ConfigClock(clock)
+
+	var got *Event
+	s.events.add(EventListenerFunc(func(event *Event) {
+		got = event
+	}), false)
+	s.emit(EventLogin, "1", "1_a", 10, "")
+	if got == nil || got.Time != 1000 {
+		t.Fatalf("event time should follow the clock: %#v", got)
+	}
+
+	// tenant view share the clock
+	view, err := s.ForTenant("t1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if view.(*RedisSession).events.clock != clock {
+		t.Fatal("tenant view should keep the clock")
+	}
+
+	cache := newLocalCache(2, time.Minute, s.now)
+	cache.set(&User{Id: "1", Token: "1_a", TokenRemainLiveTime: 100}, false)
+	if _, ok := cache.get("1_a", false); !ok {
+		t.Fatal("entry should hit")
+	}
+
+	clock.Advance(2 * time.Minute)
+	if _, ok := cache.get("1_a", false); ok {
+		t.Fatal("entry should stale by the clock")
+	}
+}
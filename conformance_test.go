@@ -0,0 +1,66 @@
+package gosession_test
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hunterhug/gosession"
+	"github.com/hunterhug/gosession/sessiontest"
+)
+
+func TestConformanceStoreSession(t *testing.T) {
+	sessiontest.RunConformanceWithClock(t, func(t *testing.T, clock gosession.Clock) gosession.TokenManage {
+		// clock of memory store follow the session
+		s, err := gosession.NewStoreSession(gosession.NewMemoryStore())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s.(*gosession.StoreSession).ConfigClock(clock)
+	})
+}
+
+func TestConformanceFileSession(t *testing.T) {
+	sessiontest.RunConformanceWithClock(t, func(t *testing.T, clock gosession.Clock) gosession.TokenManage {
+		s, err := gosession.NewFileSession(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = s.(*gosession.FileSession).Close() })
+		return s.(*gosession.FileSession).ConfigClock(clock)
+	})
+}
+
+func TestConformanceSQLSession(t *testing.T) {
+	sessiontest.RunConformanceWithClock(t, func(t *testing.T, clock gosession.Clock) gosession.TokenManage {
+		// fake driver register in sql_session_test.go
+		db, err := sql.Open("gosession-fake", fmt.Sprintf("conformance-%d", time.Now().UnixNano()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = db.Close() })
+
+		s, err := gosession.NewSQLSession(db, gosession.DialectSQLite)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s.(*gosession.SQLSession).ConfigClock(clock)
+	})
+}
+
+func TestConformanceRedisSession(t *testing.T) {
+	// same redis as debug() in redis_session_test.go, skip when not running
+	_, err := gosession.NewRedisSessionSimple("127.0.0.1:6379", 0, "hunterhug")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	sessiontest.RunConformance(t, func(t *testing.T) gosession.TokenManage {
+		s, err := gosession.NewRedisSessionSimple("127.0.0.1:6379", 0, "hunterhug")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}
@@ -0,0 +1,134 @@
+package gosession
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// EventAsyncQueueSize async listener event queue size, event is dropped and counted when full, not block the request
+var EventAsyncQueueSize = 1024
+
+// EventType type of session event
+type EventType string
+
+const (
+	EventLogin   EventType = "login"   // new token set
+	EventRefresh EventType = "refresh" // token expire time refresh
+	EventLogout  EventType = "logout"  // token deleted by call such DeleteToken, DeleteUserToken
+	EventEvict   EventType = "evict"   // token destroyed by single mode when new token set
+	EventExpire  EventType = "expire"  // token found expire, such when check or list token
+	EventRotate  EventType = "rotate"  // new token issued to replace the old one, old one revoke after grace time
+
+	EventSuspicious  EventType = "suspicious"  // token used by client not match the binding
+	EventImpersonate EventType = "impersonate" // token which actor log in as the user set, for audit
+	EventElevate     EventType = "elevate"     // token authentication assurance level upgrade, such mfa passed
+
+	EventRevokeAll   EventType = "revoke_all"   // all token of user deleted, after logout event of each token
+	EventUserUpdated EventType = "user_updated" // user info cache refresh or delete
+	EventBanned      EventType = "banned"       // token revoked because user banned, by BanUser or check token after ban
+
+	EventLock   EventType = "lock"   // login of user or ip locked by LoginGuard after too many failure
+	EventUnlock EventType = "unlock" // login lock of user or ip expire or reset
+)
+
+// Event session event, listener should not modify it
+type Event struct {
+	Type     EventType `json:"type"`                // what happen
+	TenantId string    `json:"tenant_id,omitempty"` // which tenant, empty means root
+	UserId   string    `json:"user_id"`             // whose token
+	IP       string    `json:"ip,omitempty"`        // client ip, only login guard event has it
+	ActorId  string    `json:"actor_id,omitempty"`  // who log in as the user, only impersonation event has it
+	Token    string    `json:"token,omitempty"`     // token handle, empty when event not about one token
+	OldToken string    `json:"old_token,omitempty"` // token replaced by rotate
+	TTL      int64     `json:"ttl,omitempty"`       // token remain live second after event
+	Reason   string    `json:"reason,omitempty"`    // why happen
+	Time     int64     `json:"time"`                // unix second when happen
+}
+
+// EventListener listen session event
+type EventListener interface {
+	OnEvent(event *Event)
+}
+
+// EventListenerFunc func as event listener
+type EventListenerFunc func(event *Event)
+
+// OnEvent call f(event)
+func (f EventListenerFunc) OnEvent(event *Event) {
+	f(event)
+}
+
+// eventHub dispatch event to listener, sync listener run in the goroutine of emit,
+// async listener run in its own goroutine by order
+type eventHub struct {
+	mu        sync.RWMutex
+	listeners []*eventListenerEntry
+	dropped   int64  // event dropped because queue of async listener full
+	tenantId  string // event of tenant view stamp it before dispatch, empty means root
+	clock     Clock  // where event time get, nil means SystemClock, config before use
+}
+
+type eventListenerEntry struct {
+	listener EventListener
+	queue    chan *Event // nil when sync
+}
+
+func newEventHub() *eventHub {
+	return new(eventHub)
+}
+
+func (h *eventHub) add(listener EventListener, async bool) {
+	if listener == nil {
+		return
+	}
+
+	entry := &eventListenerEntry{listener: listener}
+	if async {
+		entry.queue = make(chan *Event, EventAsyncQueueSize)
+		go func() {
+			for event := range entry.queue {
+				entry.listener.OnEvent(event)
+			}
+		}()
+	}
+
+	h.mu.Lock()
+	h.listeners = append(h.listeners, entry)
+	h.mu.Unlock()
+}
+
+func (h *eventHub) emit(event *Event) {
+	h.mu.RLock()
+	listeners := h.listeners
+	h.mu.RUnlock()
+
+	if len(listeners) == 0 {
+		return
+	}
+
+	if event.Time == 0 {
+		event.Time = clockNow(h.clock).Unix()
+	}
+
+	if event.TenantId == "" {
+		event.TenantId = h.tenantId
+	}
+
+	for _, entry := range listeners {
+		if entry.queue != nil {
+			select {
+			case entry.queue <- event:
+			default:
+				atomic.AddInt64(&h.dropped, 1)
+			}
+			continue
+		}
+
+		entry.listener.OnEvent(event)
+	}
+}
+
+// how many event dropped because queue of async listener full
+func (h *eventHub) droppedCount() int64 {
+	return atomic.LoadInt64(&h.dropped)
+}
@@ -0,0 +1,103 @@
+package gosession
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEventHub(t *testing.T) {
+	hub := newEventHub()
+
+	var syncEvents []*Event
+	hub.add(EventListenerFunc(func(event *Event) {
+		syncEvents = append(syncEvents, event)
+	}), false)
+
+	asyncEvents := make(chan *Event, 10)
+	hub.add(EventListenerFunc(func(event *Event) {
+		asyncEvents <- event
+	}), true)
+
+	hub.emit(&Event{Type: EventLogin, UserId: "1", Token: "1_a", TTL: 10})
+	hub.emit(&Event{Type: EventLogout, UserId: "1", Token: "1_a"})
+
+	if len(syncEvents) != 2 || syncEvents[0].Type != EventLogin || syncEvents[0].Time == 0 {
+		t.Fatalf("sync listener wrong: %#v", syncEvents)
+	}
+
+	// async listener keep the order
+	for _, want := range []EventType{EventLogin, EventLogout} {
+		select {
+		case event := <-asyncEvents:
+			if event.Type != want {
+				t.Fatalf("async listener order wrong: %s", event.Type)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("async listener not called")
+		}
+	}
+}
+
+func TestEventHubDropWhenFull(t *testing.T) {
+	size := EventAsyncQueueSize
+	EventAsyncQueueSize = 1
+	defer func() { EventAsyncQueueSize = size }()
+
+	block := make(chan struct{})
+	hub := newEventHub()
+	hub.add(EventListenerFunc(func(event *Event) { <-block }), true)
+
+	// first one taken by listener and block, second one in queue, others dropped not block emit
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 5; i++ {
+			hub.emit(&Event{Type: EventLogin})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("emit should not block when queue full")
+	}
+	close(block)
+
+	if n := hub.droppedCount(); n < 3 || n > 4 {
+		t.Fatalf("dropped %d event, want 3 or 4", n)
+	}
+}
+
+func TestExpireEventOnce(t *testing.T) {
+	s := newTestRedisSession(t)
+
+	var mu sync.Mutex
+	expired := 0
+	s.AddEventListener(EventListenerFunc(func(event *Event) {
+		if event.Type == EventExpire {
+			mu.Lock()
+			expired++
+			mu.Unlock()
+		}
+	}), false)
+
+	if _, err := s.SetToken("1", 1); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2100 * time.Millisecond)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = s.ListUserToken("1")
+		}()
+	}
+	wg.Wait()
+
+	if expired != 1 {
+		t.Fatalf("concurrent list should emit expire once, got %d", expired)
+	}
+}
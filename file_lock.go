@@ -0,0 +1,44 @@
+//go:build !windows
+// +build !windows
+
+package gosession
+
+import (
+	"os"
+	"syscall"
+)
+
+// lock the dir by flock, released by os when process die
+func lockDir(name string) (*os.File, error) {
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err != nil {
+		_ = f.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, ErrFileLocked
+		}
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// fsync the dir so rename in it will not lost when power off
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+
+	err = f.Sync()
+	errClose := f.Close()
+	if err == nil {
+		err = errClose
+	}
+
+	return err
+}
@@ -0,0 +1,35 @@
+//go:build windows
+// +build windows
+
+package gosession
+
+import (
+	"os"
+	"syscall"
+)
+
+// ERROR_SHARING_VIOLATION, lock file opened by other
+const errorSharingViolation syscall.Errno = 32
+
+// lock the dir by open lock file not share, released by os when process die
+func lockDir(name string) (*os.File, error) {
+	path, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := syscall.CreateFile(path, syscall.GENERIC_READ|syscall.GENERIC_WRITE, 0, nil, syscall.OPEN_ALWAYS, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		if err == errorSharingViolation {
+			return nil, ErrFileLocked
+		}
+		return nil, err
+	}
+
+	return os.NewFile(uintptr(h), name), nil
+}
+
+// windows can not fsync dir, nothing to do
+func syncDir(dir string) error {
+	return nil
+}
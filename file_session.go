@@ -0,0 +1,716 @@
+package gosession
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrFileLocked dir is opened by other FileSession or process
+	ErrFileLocked = errors.New("file session dir locked by other")
+
+	// FileCompactThreshold compact when this many op append to log after last snapshot
+	FileCompactThreshold int64 = 10000
+)
+
+const (
+	fileSnapshotName = "snapshot.json" // full state when last compact
+	fileLogName      = "session.log"   // op after snapshot, one json each line
+	fileLockName     = "lock"          // hold by the process open the dir
+
+	fileOpSetToken      = "set_token"
+	fileOpDeleteToken   = "delete_token"
+	fileOpDeleteUserTok = "delete_user_token"
+	fileOpSetUser       = "set_user"
+	fileOpDeleteUser    = "delete_user"
+)
+
+// fileOp one line of log, replay it again get the same state
+type fileOp struct {
+	Op        string          `json:"op"`
+	Token     string          `json:"token,omitempty"`
+	UserId    string          `json:"user_id,omitempty"`
+	ExpiresAt int64           `json:"expires_at,omitempty"`
+	Detail    json.RawMessage `json:"detail,omitempty"`
+}
+
+// fileState all data in memory, and the snapshot content
+type fileState struct {
+	Tokens map[string]*fileToken `json:"tokens"` // token and whose
+	Users  map[string]*fileUser  `json:"users"`  // user info cache
+}
+
+type fileToken struct {
+	UserId    string `json:"user_id"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+type fileUser struct {
+	Detail    json.RawMessage `json:"detail"`
+	ExpiresAt int64           `json:"expires_at"`
+}
+
+// FileSession session persist in local dir, every change append to log file, state in memory,
+// snapshot and truncate the log when compact, recover by load snapshot and replay log when open.
+// Only one process can open the same dir, lock file in dir make sure of it.
+type FileSession struct {
+	mu           sync.RWMutex
+	dir          string
+	lock         *os.File // lock file, close it release the dir
+	log          *os.File
+	logOps       int64                          // op in log after snapshot
+	syncWrite    bool                           // fsync after every write, default true
+	tokens       map[string]*fileToken          // token index
+	userTokens   map[string]map[string]struct{} // all token of user
+	users        map[string]*fileUser           // user info cache
+	getUserFunc  func(id string) (*User, error) // when not hit cache will get user from this func
+	expireTime   int64                          // token expire how much second，default  7 days
+	isSingleMode bool                           // is single token, new token will destroy other token
+	events       *eventHub                      // session event listener
+	clock        Clock                          // where get now, nil means SystemClock
+	stop         chan struct{}                  // stop background sweep, nil when not start
+}
+
+// NewFileSession open or create session in dir, data in it will be recovered,
+// return ErrFileLocked when dir opened by other and not closed
+func NewFileSession(dir string) (TokenManage, error) {
+	if dir == "" {
+		return nil, errors.New("dir empty")
+	}
+
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	lock, err := lockDir(filepath.Join(dir, fileLockName))
+	if err != nil {
+		return nil, err
+	}
+
+	s := &FileSession{
+		dir:        dir,
+		lock:       lock,
+		syncWrite:  true,
+		tokens:     make(map[string]*fileToken),
+		userTokens: make(map[string]map[string]struct{}),
+		users:      make(map[string]*fileUser),
+		expireTime: expireTimeDefault,
+		events:     newEventHub(),
+	}
+
+	err = s.recover()
+	if err != nil {
+		_ = lock.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// load snapshot and replay log, half write last line by crash will be cut,
+// broken line in the middle is not by crash, return error and not touch the log
+func (s *FileSession) recover() error {
+	raw, err := os.ReadFile(filepath.Join(s.dir, fileSnapshotName))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if err == nil {
+		state := new(fileState)
+		err = json.Unmarshal(raw, state)
+		if err != nil {
+			return fmt.Errorf("snapshot broken: %w", err)
+		}
+
+		for token, t := range state.Tokens {
+			s.applySetToken(token, t.UserId, t.ExpiresAt)
+		}
+
+		for userId, u := range state.Users {
+			s.users[userId] = u
+		}
+	}
+
+	log, err := os.OpenFile(filepath.Join(s.dir, fileLogName), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(log)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			_ = log.Close()
+			return err
+		}
+
+		op := new(fileOp)
+		errParse := json.Unmarshal(line, op)
+		if errParse != nil {
+			// valid op after it, cut there will lose them
+			_, errPeek := reader.Peek(1)
+			if errPeek != io.EOF {
+				_ = log.Close()
+				return fmt.Errorf("log broken at offset %d: %w", offset, errParse)
+			}
+			break
+		}
+
+		s.apply(op)
+		s.logOps++
+		offset += int64(len(line))
+	}
+
+	// cut the half write line
+	err = log.Truncate(offset)
+	if err == nil {
+		_, err = log.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		_ = log.Close()
+		return err
+	}
+
+	s.log = log
+	s.sweep(s.now().Unix())
+	return nil
+}
+
+// ConfigFileSync config by chain, fsync after every write, disable it faster but may lost the last write when os crash
+func (s *FileSession) ConfigFileSync(on bool) TokenManage {
+	s.mu.Lock()
+	s.syncWrite = on
+	s.mu.Unlock()
+	return s
+}
+
+// ConfigTokenKeyPrefix config by chain, file has no key, nothing to do
+func (s *FileSession) ConfigTokenKeyPrefix(tokenKey string) TokenManage {
+	return s
+}
+
+// ConfigUserKeyPrefix config by chain, file has no key, nothing to do
+func (s *FileSession) ConfigUserKeyPrefix(userKey string) TokenManage {
+	return s
+}
+
+// ConfigDefaultExpireTime config by chain
+func (s *FileSession) ConfigDefaultExpireTime(second int64) TokenManage {
+	if second > 0 {
+		s.expireTime = second
+	}
+	return s
+}
+
+// ConfigGetUserInfoFunc config by chain
+func (s *FileSession) ConfigGetUserInfoFunc(fn GetUserInfoFunc) TokenManage {
+	s.getUserFunc = fn
+	return s
+}
+
+// AddEventListener config by chain
+func (s *FileSession) AddEventListener(listener EventListener, async bool) TokenManage {
+	s.events.add(listener, async)
+	return s
+}
+
+// SetSingleMode config by chain
+func (s *FileSession) SetSingleMode() TokenManage {
+	s.isSingleMode = true
+	return s
+}
+
+// SetToken Set token, expire after some second
+func (s *FileSession) SetToken(userId string, tokenValidTimes int64) (token string, err error) {
+	if userId == "" {
+		err = errors.New("user id nil")
+		return
+	}
+
+	if tokenValidTimes <= 0 {
+		tokenValidTimes = s.expireTime
+	}
+
+	// if single, destroy other token first
+	if s.isSingleMode {
+		err = s.deleteUserToken(userId, EventEvict, "single mode")
+		if err != nil {
+			return "", err
+		}
+	}
+
+	token = fmt.Sprintf("%s_%s", userId, GetGUID())
+	err = s.write(&fileOp{Op: fileOpSetToken, Token: token, UserId: userId, ExpiresAt: s.now().Unix() + tokenValidTimes})
+	if err != nil {
+		return "", err
+	}
+
+	s.emit(EventLogin, userId, token, tokenValidTimes, "")
+	return token, nil
+}
+
+// RefreshToken Refresh token，token expire will be again after some second, not exist will set a new one
+func (s *FileSession) RefreshToken(token string, tokenValidTimes int64) (err error) {
+	userId, err := tokenUserId(token)
+	if err != nil {
+		return err
+	}
+
+	if tokenValidTimes <= 0 {
+		tokenValidTimes = s.expireTime
+	}
+
+	err = s.write(&fileOp{Op: fileOpSetToken, Token: token, UserId: userId, ExpiresAt: s.now().Unix() + tokenValidTimes})
+	if err != nil {
+		return err
+	}
+
+	s.emit(EventRefresh, userId, token, tokenValidTimes, "")
+	return nil
+}
+
+// DeleteToken Delete token when you do action such logout
+func (s *FileSession) DeleteToken(token string) (err error) {
+	userId, err := tokenUserId(token)
+	if err != nil {
+		return err
+	}
+
+	s.mu.RLock()
+	_, exist := s.tokens[token]
+	s.mu.RUnlock()
+	if !exist {
+		return nil
+	}
+
+	err = s.write(&fileOp{Op: fileOpDeleteToken, Token: token, UserId: userId})
+	if err != nil {
+		return err
+	}
+
+	s.emit(EventLogout, userId, token, 0, "delete token")
+	return nil
+}
+
+// CheckToken Check the token, but not refresh user info cache
+func (s *FileSession) CheckToken(token string) (user *User, exist bool, err error) {
+	return s.CheckTokenOrUpdateUser(token, -1)
+}
+
+// CheckTokenOrUpdateUser Check the token, when user info cache exist return directly,
+// others load by getUserFunc and save in cache, if s.getUserFunc == nil do nothing
+func (s *FileSession) CheckTokenOrUpdateUser(token string, userInfoValidTimes int64) (user *User, exist bool, err error) {
+	userId, err := tokenUserId(token)
+	if err != nil {
+		return nil, false, err
+	}
+
+	now := s.now().Unix()
+	s.mu.RLock()
+	t, exist := s.tokens[token]
+	var cached *fileUser
+	if exist {
+		cached = s.users[userId]
+	}
+	s.mu.RUnlock()
+
+	if !exist || t.UserId != userId || t.ExpiresAt <= now {
+		return nil, false, nil
+	}
+
+	if s.getUserFunc == nil || userInfoValidTimes < 0 {
+		user = new(User)
+		user.Id = userId
+	} else if cached != nil && cached.ExpiresAt > now {
+		user = new(User)
+		err = json.Unmarshal(cached.Detail, user)
+		if err != nil {
+			return nil, false, err
+		}
+		user.Id = userId
+	} else {
+		user, exist, err = s.AddUser(userId, userInfoValidTimes)
+		if err != nil || !exist {
+			return nil, false, err
+		}
+	}
+
+	user.Token = token
+	user.TokenRemainLiveTime = t.ExpiresAt - now
+	user.TokenExpireTime = t.ExpiresAt
+	return user, true, nil
+}
+
+// ListUserToken List all live token in one user
+func (s *FileSession) ListUserToken(userId string) ([]string, error) {
+	if userId == "" {
+		return nil, errors.New("user id empty")
+	}
+
+	now := s.now().Unix()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]string, 0, len(s.userTokens[userId]))
+	for token := range s.userTokens[userId] {
+		if t, ok := s.tokens[token]; ok && t.ExpiresAt > now {
+			result = append(result, token)
+		}
+	}
+
+	return result, nil
+}
+
+// DeleteUserToken Delete all token of this user
+func (s *FileSession) DeleteUserToken(userId string) (err error) {
+	err = s.deleteUserToken(userId, EventLogout, "delete user token")
+	if err != nil {
+		return err
+	}
+
+	s.emit(EventRevokeAll, userId, "", 0, "delete user token")
+	return nil
+}
+
+// delete all token of this user, every token will emit event eventType
+func (s *FileSession) deleteUserToken(userId string, eventType EventType, reason string) (err error) {
+	tokens, err := s.ListUserToken(userId)
+	if err != nil {
+		return err
+	}
+
+	err = s.write(&fileOp{Op: fileOpDeleteUserTok, UserId: userId})
+	if err != nil {
+		return err
+	}
+
+	for _, token := range tokens {
+		s.emit(eventType, userId, token, 0, reason)
+	}
+
+	return nil
+}
+
+// RefreshUser Refresh cache of user info batch
+func (s *FileSession) RefreshUser(ids []string, userInfoValidTimes int64) (err error) {
+	for _, id := range ids {
+		_, _, err = s.AddUser(id, userInfoValidTimes)
+		if err != nil {
+			return err
+		}
+
+		// cache fill by check not emit, only here and DeleteUser
+		s.emit(EventUserUpdated, id, "", 0, "refresh user")
+	}
+
+	return nil
+}
+
+// DeleteUser Delete user info in cache
+func (s *FileSession) DeleteUser(userId string) (err error) {
+	if userId == "" {
+		err = errors.New("user id empty")
+		return
+	}
+
+	err = s.write(&fileOp{Op: fileOpDeleteUser, UserId: userId})
+	if err != nil {
+		return err
+	}
+
+	s.emit(EventUserUpdated, userId, "", 0, "delete user")
+	return nil
+}
+
+// AddUser Add the user info to cache，expire after some second
+func (s *FileSession) AddUser(userId string, userInfoValidTimes int64) (user *User, exist bool, err error) {
+	if s.getUserFunc == nil {
+		return nil, false, errors.New("getUserFunc nil")
+	}
+
+	if userId == "" {
+		err = errors.New("user id empty")
+		return
+	}
+
+	user, err = s.getUserFunc(userId)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	if user == nil {
+		user = new(User)
+	}
+
+	user.Id = userId
+
+	raw, err := json.Marshal(user)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if userInfoValidTimes <= 0 {
+		userInfoValidTimes = s.expireTime
+	}
+
+	err = s.write(&fileOp{Op: fileOpSetUser, UserId: userId, Detail: raw, ExpiresAt: s.now().Unix() + userInfoValidTimes})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return user, true, nil
+}
+
+// Start sweep expired token and user every interval in background, and compact when log too long
+func (s *FileSession) Start(interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	s.mu.Lock()
+	if s.stop != nil {
+		close(s.stop)
+	}
+	stop := make(chan struct{})
+	s.stop = stop
+	s.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				s.mu.Lock()
+				s.sweep(s.now().Unix())
+				s.mu.Unlock()
+
+				err := s.compactIfNeed()
+				if err != nil {
+				}
+			}
+		}
+	}()
+}
+
+// Close stop background sweep, compact and close the log, release the dir, can not use after it
+func (s *FileSession) Close() (err error) {
+	err = s.Compact()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+
+	if s.log != nil {
+		errClose := s.log.Close()
+		if err == nil {
+			err = errClose
+		}
+		s.log = nil
+	}
+
+	if s.lock != nil {
+		errClose := s.lock.Close()
+		if err == nil {
+			err = errClose
+		}
+		s.lock = nil
+	}
+
+	return err
+}
+
+// Compact write snapshot of live data and truncate the log
+func (s *FileSession) Compact() (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.compact()
+}
+
+func (s *FileSession) compactIfNeed() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.logOps < FileCompactThreshold {
+		return nil
+	}
+	return s.compact()
+}
+
+// write snapshot to temp file then rename, crash at any time the old or new snapshot is whole,
+// log replay again on new snapshot get the same state
+func (s *FileSession) compact() (err error) {
+	if s.log == nil {
+		return errors.New("file session closed")
+	}
+
+	s.sweep(s.now().Unix())
+	state := &fileState{Tokens: s.tokens, Users: s.users}
+	raw, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(s.dir, fileSnapshotName+".tmp")
+	err = writeFileSync(tmp, raw)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmp, filepath.Join(s.dir, fileSnapshotName))
+	if err != nil {
+		return err
+	}
+
+	// rename must be on disk before truncate, or power off may keep old snapshot and empty log
+	err = syncDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	err = s.log.Truncate(0)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.log.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	s.logOps = 0
+	return s.log.Sync()
+}
+
+// append op to log then apply in memory
+func (s *FileSession) write(op *fileOp) error {
+	raw, err := json.Marshal(op)
+	if err != nil {
+		return err
+	}
+	raw = append(raw, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.log == nil {
+		return errors.New("file session closed")
+	}
+
+	_, err = s.log.Write(raw)
+	if err != nil {
+		return err
+	}
+
+	if s.syncWrite {
+		err = s.log.Sync()
+		if err != nil {
+			return err
+		}
+	}
+
+	s.apply(op)
+	s.logOps++
+	return nil
+}
+
+// change memory state by op, lock hold by caller
+func (s *FileSession) apply(op *fileOp) {
+	switch op.Op {
+	case fileOpSetToken:
+		s.applySetToken(op.Token, op.UserId, op.ExpiresAt)
+	case fileOpDeleteToken:
+		s.applyDeleteToken(op.Token)
+	case fileOpDeleteUserTok:
+		for token := range s.userTokens[op.UserId] {
+			delete(s.tokens, token)
+		}
+		delete(s.userTokens, op.UserId)
+	case fileOpSetUser:
+		s.users[op.UserId] = &fileUser{Detail: op.Detail, ExpiresAt: op.ExpiresAt}
+	case fileOpDeleteUser:
+		delete(s.users, op.UserId)
+	}
+}
+
+func (s *FileSession) applySetToken(token string, userId string, expiresAt int64) {
+	s.tokens[token] = &fileToken{UserId: userId, ExpiresAt: expiresAt}
+	if s.userTokens[userId] == nil {
+		s.userTokens[userId] = make(map[string]struct{})
+	}
+	s.userTokens[userId][token] = struct{}{}
+}
+
+func (s *FileSession) applyDeleteToken(token string) {
+	t, ok := s.tokens[token]
+	if !ok {
+		return
+	}
+
+	delete(s.tokens, token)
+	delete(s.userTokens[t.UserId], token)
+	if len(s.userTokens[t.UserId]) == 0 {
+		delete(s.userTokens, t.UserId)
+	}
+}
+
+// drop expired data in memory, not need log, replay get the same expire time, lock hold by caller
+func (s *FileSession) sweep(now int64) {
+	for token, t := range s.tokens {
+		if t.ExpiresAt <= now {
+			s.applyDeleteToken(token)
+		}
+	}
+
+	for userId, u := range s.users {
+		if u.ExpiresAt <= now {
+			delete(s.users, userId)
+		}
+	}
+}
+
+// EventDropped how many event dropped because queue of async listener full
+func (s *FileSession) EventDropped() int64 {
+	return s.events.droppedCount()
+}
+
+// emit session event to listener
+func (s *FileSession) emit(eventType EventType, userId string, token string, ttl int64, reason string) {
+	s.events.emit(&Event{Type: eventType, UserId: userId, Token: token, TTL: ttl, Reason: reason})
+}
+
+func writeFileSync(name string, raw []byte) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(raw)
+	if err == nil {
+		err = f.Sync()
+	}
+
+	errClose := f.Close()
+	if err == nil {
+		err = errClose
+	}
+
+	return err
+}
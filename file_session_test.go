@@ -0,0 +1,203 @@
+package gosession
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileSessionRecover(t *testing.T) {
+	dir := t.TempDir()
+	tm, err := NewFileSession(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := tm.(*FileSession)
+	s.ConfigGetUserInfoFunc(func(id string) (*User, error) { return &User{Id: id, Detail: "detail " + id}, nil })
+
+	token1, err := s.SetToken("1", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token2, _ := s.SetToken("1", 100)
+	token3, _ := s.SetToken("2", 100)
+	if _, _, err = s.CheckTokenOrUpdateUser(token1, 100); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.DeleteToken(token2); err != nil {
+		t.Fatal(err)
+	}
+
+	// crash with a half write line, os release the lock
+	_ = s.log.Close()
+	_ = s.lock.Close()
+	f, err := os.OpenFile(filepath.Join(dir, fileLogName), os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"op":"delete_user_token","user_`)
+	_ = f.Close()
+
+	check := func(s *FileSession) {
+		user, exist, err := s.CheckTokenOrUpdateUser(token1, 100)
+		if err != nil || !exist || user.Detail != "detail 1" {
+			t.Fatalf("token1 should recover: %#v %v %v", user, exist, err)
+		}
+
+		if _, exist, _ := s.CheckToken(token2); exist {
+			t.Fatal("deleted token2 should not recover")
+		}
+
+		if _, exist, _ := s.CheckToken(token3); !exist {
+			t.Fatal("token3 should recover")
+		}
+	}
+
+	tm, err = NewFileSession(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = tm.(*FileSession)
+	s.ConfigGetUserInfoFunc(func(id string) (*User, error) { return nil, ErrUserNotFound })
+	check(s)
+
+	// snapshot and empty log
+	if err = s.Compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	if info, err := os.Stat(filepath.Join(dir, fileLogName)); err != nil || info.Size() != 0 {
+		t.Fatalf("log should be empty after compact: %v", err)
+	}
+
+	if err = s.DeleteUserToken("2"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tm, err = NewFileSession(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = tm.(*FileSession)
+	s.ConfigGetUserInfoFunc(func(id string) (*User, error) { return nil, ErrUserNotFound })
+	if _, exist, _ := s.CheckToken(token3); exist {
+		t.Fatal("token of deleted user should not recover")
+	}
+
+	if tokens, _ := s.ListUserToken("1"); len(tokens) != 1 || tokens[0] != token1 {
+		t.Fatalf("list token wrong: %v", tokens)
+	}
+}
+
+func TestFileSessionBrokenLog(t *testing.T) {
+	dir := t.TempDir()
+	tm, err := NewFileSession(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := tm.(*FileSession)
+	token1, _ := s.SetToken("1", 100)
+	_ = s.log.Close()
+	_ = s.lock.Close()
+
+	// broken line in the middle, valid op after it
+	name := filepath.Join(dir, fileLogName)
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString("{broken\n")
+	_, _ = f.WriteString(`{"op":"set_token","token":"2_a","user_id":"2","expires_at":` + fmt.Sprint(time.Now().Unix()+100) + "}\n")
+	_ = f.Close()
+
+	before, _ := os.Stat(name)
+	if _, err = NewFileSession(dir); err == nil {
+		t.Fatal("broken line in the middle should fail")
+	}
+
+	if after, _ := os.Stat(name); after.Size() != before.Size() {
+		t.Fatal("broken log should not be cut")
+	}
+
+	// broken last line is half write, cut it
+	f, _ = os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0600)
+	_, _ = f.WriteString("{half")
+	_ = f.Close()
+	if _, err = NewFileSession(dir); err == nil {
+		t.Fatal("broken line in the middle should still fail")
+	}
+
+	raw, _ := os.ReadFile(name)
+	fixed := strings.Replace(string(raw), "{broken\n", "", 1)
+	if err = os.WriteFile(name, []byte(fixed), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tm, err = NewFileSession(dir)
+	if err != nil {
+		t.Fatalf("half write last line should be cut: %v", err)
+	}
+	s = tm.(*FileSession)
+	defer s.Close()
+
+	if _, exist, _ := s.CheckToken(token1); !exist {
+		t.Fatal("token1 should recover")
+	}
+
+	if _, exist, _ := s.CheckToken("2_a"); !exist {
+		t.Fatal("token after the fixed line should recover")
+	}
+}
+
+func TestFileSessionLock(t *testing.T) {
+	dir := t.TempDir()
+	tm, err := NewFileSession(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = NewFileSession(dir); !errors.Is(err, ErrFileLocked) {
+		t.Fatalf("open locked dir should fail: %v", err)
+	}
+
+	if err = tm.(*FileSession).Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tm, err = NewFileSession(dir)
+	if err != nil {
+		t.Fatalf("open after close: %v", err)
+	}
+	_ = tm.(*FileSession).Close()
+}
+
+func TestFileSessionSweep(t *testing.T) {
+	tm, err := NewFileSession(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := tm.(*FileSession)
+	defer s.Close()
+
+	token, _ := s.SetToken("1", 100)
+	s.sweep(time.Now().Unix() + 101)
+	if _, exist, _ := s.CheckToken(token); exist {
+		t.Fatal("expired token should be swept")
+	}
+
+	if len(s.tokens) != 0 || len(s.userTokens) != 0 {
+		t.Fatal("index should be empty after sweep")
+	}
+}
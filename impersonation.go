@@ -0,0 +1,223 @@
+package gosession
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// ImpersonationExpireTimeDefault impersonation token expire second when ttl not set
+var ImpersonationExpireTimeDefault int64 = 3600
+
+// SetImpersonationToken Set token which actor such support staff log in as the target user, expire after ttl second, default 1 hour.
+// Check the token return the target user with ImpersonatorId, it not list in ListUserToken of target,
+// and revoked when DeleteUserToken or BanUser of actor or target. EventImpersonate emit for audit.
+func (s *RedisSession) SetImpersonationToken(actorId string, targetUserId string, ttl int64, reason string) (token string, err error) {
+	if actorId == "" || targetUserId == "" {
+		err = errors.New("actor id or target user id empty")
+		return
+	}
+
+	if actorId == targetUserId {
+		err = errors.New("can not impersonate self")
+		return
+	}
+
+	if strings.Contains(actorId, "_") {
+		err = errors.New("actor id can not contain _")
+		return
+	}
+
+	if reason == "" {
+		err = errors.New("impersonation reason empty")
+		return
+	}
+
+	if ttl <= 0 {
+		ttl = ImpersonationExpireTimeDefault
+	}
+
+	// banned user can not login, even by others
+	err = s.checkBan(targetUserId)
+	if err != nil {
+		return "", err
+	}
+
+	record := &tokenRecord{
+		UserKey:        s.hashUserKey(targetUserId),
+		CreateTime:     s.now().Unix(),
+		ImpersonatorId: actorId,
+	}
+	ttl = s.capTokenTTL(record, ttl)
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return "", err
+	}
+
+	token = s.genImpersonationToken(targetUserId, actorId)
+
+	conn := s.pool.Get()
+	if conn.Err() != nil {
+		err = conn.Err()
+		return "", err
+	}
+
+	defer func(conn redis.Conn) {
+		err := conn.Close()
+		if err != nil {
+		}
+	}(conn)
+
+	err = conn.Send("MULTI")
+	if err != nil {
+		return "", err
+	}
+
+	err = conn.Send("SETEX", s.hashTokenKey(token), ttl, raw)
+	if err != nil {
+		return "", err
+	}
+
+	// map of actor, and map of target so revoke the target can find it
+	for _, mapKey := range []string{s.impersonationMapKey(actorId), s.impersonationTargetMapKey(targetUserId)} {
+		err = conn.Send("HSET", mapKey, token, s.now().Unix()+ttl)
+		if err != nil {
+			return "", err
+		}
+
+		err = conn.Send("EXPIRE", mapKey, TokenMapKeyExpireTime)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	_, err = conn.Do("EXEC")
+	if err != nil {
+		return "", err
+	}
+
+	s.events.emit(&Event{Type: EventImpersonate, UserId: targetUserId, ActorId: actorId, Token: token, TTL: ttl, Reason: reason})
+	return token, nil
+}
+
+// ListImpersonationToken List all live token which actor log in as others
+func (s *RedisSession) ListImpersonationToken(actorId string) ([]string, error) {
+	if actorId == "" {
+		return nil, errors.New("actor id empty")
+	}
+
+	result, _, err := s.getUserTokenMapKeys(s.impersonationMapKey(actorId))
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// delete all token which actor log in as others
+func (s *RedisSession) deleteImpersonationToken(actorId string, eventType EventType, reason string) (err error) {
+	return s.deleteImpersonationTokenIn(s.impersonationMapKey(actorId), actorId, eventType, reason)
+}
+
+// delete all token which others log in as target
+func (s *RedisSession) deleteTargetImpersonationToken(targetUserId string, eventType EventType, reason string) (err error) {
+	return s.deleteImpersonationTokenIn(s.impersonationTargetMapKey(targetUserId), "", eventType, reason)
+}
+
+// delete all impersonation token in map, remove from map of actor and target both, actorId is for old token not has it,
+// every token deleted emit event eventType
+func (s *RedisSession) deleteImpersonationTokenIn(mapKey string, actorId string, eventType EventType, reason string) (err error) {
+	conn := s.pool.Get()
+	if conn.Err() != nil {
+		err = conn.Err()
+		return
+	}
+
+	defer func(conn redis.Conn) {
+		err := conn.Close()
+		if err != nil {
+		}
+	}(conn)
+
+	tokens, err := redis.Strings(conn.Do("HKEYS", mapKey))
+	if err != nil {
+		return err
+	}
+
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	err = conn.Send("MULTI")
+	if err != nil {
+		return err
+	}
+
+	// not DEL the map, new token may put in at the same time, empty map removed by redis
+	actors := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		actor := tokenActorId(token)
+		if actor == "" {
+			actor = actorId
+		}
+		actors = append(actors, actor)
+
+		err = conn.Send("DEL", s.hashTokenKey(token))
+		if err != nil {
+			return err
+		}
+
+		err = conn.Send("HDEL", s.impersonationMapKey(actor), token)
+		if err != nil {
+			return err
+		}
+
+		err = conn.Send("HDEL", s.impersonationTargetMapKey(strings.Split(token, "_")[0]), token)
+		if err != nil {
+			return err
+		}
+	}
+
+	// how many key deleted of each order, DEL then two HDEL of every token
+	counts, err := redis.Int64s(conn.Do("EXEC"))
+	if err != nil {
+		return err
+	}
+
+	// token deleted by others at the same time not emit again
+	for i, token := range tokens {
+		if 3*i < len(counts) && counts[3*i] > 0 {
+			userId := strings.Split(token, "_")[0]
+			s.events.emit(&Event{Type: eventType, UserId: userId, ActorId: actors[i], Token: token, Reason: reason})
+		}
+	}
+
+	return s.invalidateLocalCache(tokens, nil)
+}
+
+// impersonation token has actor id at the end, so which map store it can be known even record gone
+func (s *RedisSession) genImpersonationToken(targetUserId string, actorId string) string {
+	return fmt.Sprintf("%s_%s_%s", targetUserId, GetGUID(), actorId)
+}
+
+// actor id of impersonation token, empty means normal token
+func tokenActorId(token string) string {
+	temp := strings.Split(token, "_")
+	if len(temp) == 3 {
+		return temp[2]
+	}
+	return ""
+}
+
+// hash map key which store all token actor log in as others
+func (s *RedisSession) impersonationMapKey(actorId string) string {
+	return fmt.Sprintf("%s-imp_%s", s.tokenKey, actorId)
+}
+
+// hash map key which store all token others log in as target
+func (s *RedisSession) impersonationTargetMapKey(targetUserId string) string {
+	return fmt.Sprintf("%s-imp-target_%s", s.tokenKey, targetUserId)
+}
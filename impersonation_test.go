@@ -0,0 +1,137 @@
+package gosession
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestImpersonationToken(t *testing.T) {
+	s := newRedisSession(nil, tokenKeyDefault, userKeyDefault, expireTimeDefault)
+
+	if _, err := s.SetImpersonationToken("1", "1", 0, "help"); err == nil {
+		t.Fatal("impersonate self should fail")
+	}
+
+	if _, err := s.SetImpersonationToken("1", "2", 0, ""); err == nil {
+		t.Fatal("reason empty should fail")
+	}
+
+	// not in the device list of target
+	if s.tokenMapKeyOf("2", &tokenRecord{ImpersonatorId: "1"}) != s.impersonationMapKey("1") {
+		t.Fatal("impersonation token should store in map of actor")
+	}
+
+	if s.tokenMapKeyOf("2", &tokenRecord{}) != s.userTokenMapKey("2") {
+		t.Fatal("token should store in map of user")
+	}
+
+	user := new(User)
+	s.fillTokenUser(user, "2_a", 10, 0, &tokenRecord{ImpersonatorId: "1"})
+	if user.ImpersonatorId != "1" {
+		t.Fatalf("impersonator id wrong: %s", user.ImpersonatorId)
+	}
+}
+
+func TestImpersonationTokenMapKey(t *testing.T) {
+	s := newRedisSession(nil, tokenKeyDefault, userKeyDefault, expireTimeDefault)
+
+	token := s.genImpersonationToken("2", "1")
+	if tokenActorId(token) != "1" {
+		t.Fatalf("actor id of %s wrong", token)
+	}
+
+	if s.tokenMapKeyOfToken(token) != s.impersonationMapKey("1") {
+		t.Fatal("impersonation token should know map of actor without record")
+	}
+
+	normal := s.genToken("2")
+	if tokenActorId(normal) != "" || s.tokenMapKeyOfToken(normal) != s.userTokenMapKey("2") {
+		t.Fatal("normal token should in map of user")
+	}
+}
+
+func TestImpersonationTokenRevoke(t *testing.T) {
+	s := newTestRedisSession(t)
+
+	hasField := func(mapKey string, token string) bool {
+		t.Helper()
+		conn := s.pool.Get()
+		defer conn.Close()
+		ok, err := redis.Bool(conn.Do("HEXISTS", mapKey, token))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+
+	// delete one, both map of actor and target clean
+	token, err := s.SetImpersonationToken("1", "2", 100, "help")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !hasField(s.impersonationMapKey("1"), token) || !hasField(s.impersonationTargetMapKey("2"), token) {
+		t.Fatal("impersonation token should in map of actor and target")
+	}
+
+	if err = s.DeleteToken(token); err != nil {
+		t.Fatal(err)
+	}
+
+	if hasField(s.impersonationMapKey("1"), token) || hasField(s.impersonationTargetMapKey("2"), token) {
+		t.Fatal("deleted impersonation token should leave no map entry")
+	}
+
+	// revoke all token of target, the impersonation one too
+	token, err = s.SetImpersonationToken("1", "2", 100, "help")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.DeleteUserToken("2"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, exist, err := s.CheckToken(token); err != nil || exist {
+		t.Fatalf("impersonation token should revoke with target: %v %v", exist, err)
+	}
+
+	if tokens, err := s.ListImpersonationToken("1"); err != nil || len(tokens) != 0 {
+		t.Fatalf("actor list after target revoke: %v %v", tokens, err)
+	}
+
+	// ban target
+	token, err = s.SetImpersonationToken("1", "3", 100, "help")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.BanUser("3", time.Now().Add(time.Minute), "spam"); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = s.UnbanUser("3") }()
+
+	conn := s.pool.Get()
+	exist, err := redis.Bool(conn.Do("EXISTS", s.hashTokenKey(token)))
+	_ = conn.Close()
+	if err != nil || exist || hasField(s.impersonationMapKey("1"), token) {
+		t.Fatalf("ban target should revoke impersonation token: %v %v", exist, err)
+	}
+
+	// expire lazily by check, map of actor clean
+	token, err = s.SetImpersonationToken("1", "4", 1, "help")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(2100 * time.Millisecond)
+	if _, exist, err := s.CheckToken(token); err != nil || exist {
+		t.Fatalf("expired impersonation token: %v %v", exist, err)
+	}
+
+	if hasField(s.impersonationMapKey("1"), token) || hasField(s.impersonationTargetMapKey("4"), token) {
+		t.Fatal("expired impersonation token should leave no map entry")
+	}
+}
@@ -53,4 +53,14 @@ type JwtData struct {
 	ClientPayload map[string]interface{} `json:"client_payload,omitempty"`
 	// 服务端Session数据，保存在服务器端的数据，客户端不可看
 	ServerSessionData map[string]interface{} `json:"server_session_data,omitempty"`
+	// 令牌权限范围，空表示用户全部权限
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+// RequireScopes 令牌是否拥有全部权限范围，和 RedisSession.RequireScopes 同样规则
+func (d JwtData) RequireScopes(scopes ...string) error {
+	if !HasScopes(d.Scopes, scopes...) {
+		return ErrScopeDenied
+	}
+	return nil
 }
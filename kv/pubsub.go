@@ -0,0 +1,202 @@
+package kv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+var (
+	// SubscribePingInterval ping the subscribe connection to find it broken
+	SubscribePingInterval = 30 * time.Second
+	// SubscribeRetryInterval wait before reconnect when subscribe connection broken
+	SubscribeRetryInterval = 1 * time.Second
+)
+
+// Message pub/sub message
+type Message struct {
+	Channel string   // from which channel
+	Data    []byte   // payload of normal publish
+	Keys    []string // payload is array, such client tracking invalidate message, Data and Keys both nil means flush all
+}
+
+// Subscriber subscribe channels on a dedicated connection of pool, reconnect when broken
+//
+// Message may lost when reconnecting, OnConnect will be called every time, so you can reset your state there.
+type Subscriber struct {
+	// Pool where connection get from, connection will hold until Run return
+	Pool *redis.Pool
+
+	// Channels to subscribe
+	Channels []string
+
+	// OnConnect call before subscribe every time connect success, can be nil
+	// you can prepare connection here, such as CLIENT TRACKING
+	OnConnect func(conn redis.Conn) error
+
+	// OnMessage call when message come, in the same goroutine of Run
+	OnMessage func(msg *Message)
+}
+
+// Run subscribe until ctx done
+func (s *Subscriber) Run(ctx context.Context) error {
+	if s.Pool == nil {
+		return errors.New("redis pool is nil")
+	}
+
+	if len(s.Channels) == 0 {
+		return errors.New("channels empty")
+	}
+
+	for {
+		err := s.run(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if err != nil {
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(SubscribeRetryInterval):
+		}
+	}
+}
+
+func (s *Subscriber) run(ctx context.Context) (err error) {
+	conn := s.Pool.Get()
+	if conn.Err() != nil {
+		err = conn.Err()
+		return
+	}
+
+	defer func(conn redis.Conn) {
+		err := conn.Close()
+		if err != nil {
+		}
+	}(conn)
+
+	if s.OnConnect != nil {
+		err = s.OnConnect(conn)
+		if err != nil {
+			return
+		}
+	}
+
+	channels := make([]interface{}, 0, len(s.Channels))
+	for _, v := range s.Channels {
+		channels = append(channels, v)
+	}
+
+	err = conn.Send("SUBSCRIBE", channels...)
+	if err != nil {
+		return
+	}
+
+	err = conn.Flush()
+	if err != nil {
+		return
+	}
+
+	// only this goroutine send command after subscribe
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(SubscribePingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				// receive will get the unsubscribe reply and return
+				err := conn.Send("UNSUBSCRIBE")
+				if err == nil {
+					err = conn.Flush()
+				}
+				if err != nil {
+				}
+				return
+			case <-ticker.C:
+				err := conn.Send("PING")
+				if err == nil {
+					err = conn.Flush()
+				}
+				if err != nil {
+				}
+			}
+		}
+	}()
+
+	for {
+		reply, err := redis.Values(redis.ReceiveWithTimeout(conn, 2*SubscribePingInterval))
+		if err != nil {
+			return err
+		}
+
+		if len(reply) == 0 {
+			continue
+		}
+
+		kind, err := redis.String(reply[0], nil)
+		if err != nil {
+			return err
+		}
+
+		switch kind {
+		case "message":
+			if len(reply) != 3 {
+				return fmt.Errorf("message reply wrong: %v", reply)
+			}
+
+			msg, err := parseMessage(reply[1], reply[2])
+			if err != nil {
+				return err
+			}
+
+			if s.OnMessage != nil {
+				s.OnMessage(msg)
+			}
+		case "unsubscribe":
+			if len(reply) == 3 {
+				count, err := redis.Int(reply[2], nil)
+				if err != nil {
+					return err
+				}
+
+				if count == 0 {
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// message data can be bulk string or array of bulk string
+func parseMessage(channel interface{}, data interface{}) (msg *Message, err error) {
+	msg = new(Message)
+	msg.Channel, err = redis.String(channel, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := data.(type) {
+	case nil:
+	case []byte:
+		msg.Data = v
+	case []interface{}:
+		msg.Keys, err = redis.Strings(v, nil)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("message data type wrong: %T", data)
+	}
+
+	return msg, nil
+}
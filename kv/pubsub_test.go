@@ -0,0 +1,24 @@
+package kv
+
+import (
+	"testing"
+)
+
+func TestParseMessage(t *testing.T) {
+	msg, err := parseMessage([]byte("c"), []byte("v"))
+	if err != nil || msg.Channel != "c" || string(msg.Data) != "v" || msg.Keys != nil {
+		t.Fatalf("bulk message wrong: %#v, %v", msg, err)
+	}
+
+	// client tracking invalidate message
+	msg, err = parseMessage([]byte(TrackingInvalidateChannel), []interface{}{[]byte("k1"), []byte("k2")})
+	if err != nil || len(msg.Keys) != 2 || msg.Keys[1] != "k2" || msg.Data != nil {
+		t.Fatalf("array message wrong: %#v, %v", msg, err)
+	}
+
+	// flush all
+	msg, err = parseMessage([]byte(TrackingInvalidateChannel), nil)
+	if err != nil || msg.Keys != nil || msg.Data != nil {
+		t.Fatalf("nil message wrong: %#v, %v", msg, err)
+	}
+}
@@ -0,0 +1,68 @@
+package kv
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// TrackingInvalidateChannel channel redis send invalidate message to in RESP2 redirect mode
+const TrackingInvalidateChannel = "__redis__:invalidate"
+
+// Tracker redis 6 client side caching, CLIENT TRACKING in RESP2 redirect mode with BCAST
+//
+// The subscribe connection redirect invalidate message to itself, so when it broken, tracking stop too,
+// then OnInvalidate(nil) will be called after reconnect, you should drop all local cache.
+type Tracker struct {
+	// Pool where connection get from
+	Pool *redis.Pool
+
+	// Prefixes only key has these prefix will be tracked, empty means all key
+	Prefixes []string
+
+	// OnInvalidate keys were modified by someone, nil means drop all
+	OnInvalidate func(keys []string)
+}
+
+// Run track until ctx done
+func (t *Tracker) Run(ctx context.Context) error {
+	if t.OnInvalidate == nil {
+		return errors.New("invalidate func is nil")
+	}
+
+	s := &Subscriber{
+		Pool:     t.Pool,
+		Channels: []string{TrackingInvalidateChannel},
+		OnConnect: func(conn redis.Conn) error {
+			id, err := redis.Int64(conn.Do("CLIENT", "ID"))
+			if err != nil {
+				return err
+			}
+
+			args := []interface{}{"TRACKING", "on", "REDIRECT", id, "BCAST"}
+			for _, v := range t.Prefixes {
+				args = append(args, "PREFIX", v)
+			}
+
+			_, err = conn.Do("CLIENT", args...)
+			if err != nil {
+				return err
+			}
+
+			// message may lost when disconnect
+			t.OnInvalidate(nil)
+			return nil
+		},
+		OnMessage: func(msg *Message) {
+			if msg.Keys == nil && msg.Data != nil {
+				t.OnInvalidate([]string{string(msg.Data)})
+				return
+			}
+
+			t.OnInvalidate(msg.Keys)
+		},
+	}
+
+	return s.Run(ctx)
+}
@@ -0,0 +1,169 @@
+package gosession
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+)
+
+// localCache in process lru cache of token check result, entry live no longer than maxStale
+type localCache struct {
+	mu       sync.Mutex
+	size     int
+	maxStale time.Duration
+	ll       *list.List
+	items    map[string]*list.Element
+	gen      uint64           // add one every invalidation, result checked before it not put in
+	now      func() time.Time // clock of session
+}
+
+type localCacheEntry struct {
+	user       User      // copy of check result
+	withDetail bool      // user detail has been loaded
+	cacheTime  time.Time // when put in
+	expireTime time.Time // not use after this time
+}
+
+// now nil means real time
+func newLocalCache(size int, maxStale time.Duration, now func() time.Time) *localCache {
+	if now == nil {
+		now = time.Now
+	}
+
+	return &localCache{
+		now:      now,
+		size:     size,
+		maxStale: maxStale,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// get token check result, withDetail means user detail must have
+func (c *localCache) get(token string, withDetail bool) (*User, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.items[token]
+	if !ok {
+		return nil, false
+	}
+
+	entry := e.Value.(*localCacheEntry)
+	now := c.now()
+	if !now.Before(entry.expireTime) {
+		c.removeElement(e)
+		return nil, false
+	}
+
+	if withDetail && !entry.withDetail {
+		return nil, false
+	}
+
+	c.ll.MoveToFront(e)
+
+	user := entry.user
+	user.TokenRemainLiveTime -= int64(now.Sub(entry.cacheTime) / time.Second)
+	return &user, true
+}
+
+// generation now, take it before check the token, then setIfGeneration with it
+func (c *localCache) generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen
+}
+
+// set token check result
+func (c *localCache) set(user *User, withDetail bool) {
+	c.setIfGeneration(user, withDetail, 0, false)
+}
+
+// set token check result only when no invalidation after generation gen,
+// or a result load before DeleteToken may be cached after the invalidation
+func (c *localCache) setIfGeneration(user *User, withDetail bool, gen uint64, check bool) {
+	if user == nil || user.Token == "" {
+		return
+	}
+
+	now := c.now()
+	expireTime := now.Add(c.maxStale)
+
+	// never live longer than the token
+	tokenExpireTime := now.Add(time.Duration(user.TokenRemainLiveTime) * time.Second)
+	if tokenExpireTime.Before(expireTime) {
+		expireTime = tokenExpireTime
+	}
+
+	if !now.Before(expireTime) {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if check && c.gen != gen {
+		return
+	}
+
+	entry := &localCacheEntry{user: *user, withDetail: withDetail, cacheTime: now, expireTime: expireTime}
+	if e, ok := c.items[user.Token]; ok {
+		e.Value = entry
+		c.ll.MoveToFront(e)
+		return
+	}
+
+	c.items[user.Token] = c.ll.PushFront(entry)
+	for c.ll.Len() > c.size {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+// deleteToken remove one token
+func (c *localCache) deleteToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	if e, ok := c.items[token]; ok {
+		c.removeElement(e)
+	}
+}
+
+// deleteUser remove all token of user, token has prefix user id
+func (c *localCache) deleteUser(userId string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	prefix := userId + "_"
+	for token, e := range c.items {
+		if strings.HasPrefix(token, prefix) {
+			c.removeElement(e)
+		}
+	}
+}
+
+// purge remove all
+func (c *localCache) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	c.ll.Init()
+	c.items = make(map[string]*list.Element)
+}
+
+func (c *localCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.ll.Len()
+}
+
+// lock must be held by caller
+func (c *localCache) removeElement(e *list.Element) {
+	c.ll.Remove(e)
+	delete(c.items, e.Value.(*localCacheEntry).user.Token)
+}
@@ -0,0 +1,57 @@
+package gosession
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLocalCache(t *testing.T) {
+	cache := newLocalCache(2, time.Minute, nil)
+
+	cache.set(&User{Id: "1", Token: "1_a", TokenRemainLiveTime: 100}, false)
+	cache.set(&User{Id: "1", Token: "1_b", TokenRemainLiveTime: 100}, true)
+
+	if _, ok := cache.get("1_a", true); ok {
+		t.Fatal("entry without detail should not hit")
+	}
+
+	if u, ok := cache.get("1_a", false); !ok || u.Id != "1" {
+		t.Fatal("entry should hit")
+	}
+
+	// 1_b is the least recently used one
+	cache.set(&User{Id: "2", Token: "2_a", TokenRemainLiveTime: 100}, false)
+	if _, ok := cache.get("1_b", false); ok {
+		t.Fatal("entry should be evicted")
+	}
+
+	cache.deleteUser("1")
+	if cache.len() != 1 {
+		t.Fatal("user entry should be removed, remain:", cache.len())
+	}
+
+	// never live longer than the token
+	cache.set(&User{Id: "3", Token: "3_a", TokenRemainLiveTime: 0}, false)
+	if _, ok := cache.get("3_a", false); ok {
+		t.Fatal("expired token should not cache")
+	}
+
+	cache.purge()
+	if cache.len() != 0 {
+		t.Fatal("purge should remove all, remain:", cache.len())
+	}
+
+	// invalidate after check begin, the result not put in
+	gen := cache.generation()
+	cache.deleteToken("4_a")
+	cache.setIfGeneration(&User{Id: "4", Token: "4_a", TokenRemainLiveTime: 100}, false, gen, true)
+	if _, ok := cache.get("4_a", false); ok {
+		t.Fatal("result checked before invalidation should not cache")
+	}
+
+	gen = cache.generation()
+	cache.setIfGeneration(&User{Id: "4", Token: "4_a", TokenRemainLiveTime: 100}, false, gen, true)
+	if _, ok := cache.get("4_a", false); !ok {
+		t.Fatal("result should cache when no invalidation")
+	}
+}
@@ -0,0 +1,348 @@
+package gosession
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/hunterhug/gosession/kv"
+)
+
+// record one failure in sliding window, lock when too many, lock time double every time locked again
+var loginFailureScript = redis.NewScript(4, `
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+redis.call('ZADD', KEYS[1], now, ARGV[3])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+redis.call('EXPIRE', KEYS[1], window)
+local count = redis.call('ZCARD', KEYS[1])
+if count < tonumber(ARGV[4]) then
+	return {count, 0}
+end
+local times = redis.call('INCR', KEYS[3])
+redis.call('EXPIRE', KEYS[3], ARGV[7])
+local ttl = tonumber(ARGV[5])
+for i = 2, times do
+	ttl = ttl * 2
+	if ttl >= tonumber(ARGV[6]) then
+		break
+	end
+end
+if ttl > tonumber(ARGV[6]) then
+	ttl = tonumber(ARGV[6])
+end
+redis.call('SET', KEYS[2], times, 'EX', ttl)
+redis.call('SET', KEYS[4], 1, 'EX', ARGV[7])
+redis.call('DEL', KEYS[1])
+return {count, ttl}
+`)
+
+// LoginGuardConfig config of login guard, zero value use default
+type LoginGuardConfig struct {
+	KeyPrefix       string // prefix of key, default 'gosession-guard'
+	Window          int64  // count failure in this sliding window second, default 900
+	MaxUserFailures int64  // failure of one user in window before lock, default 5, < 0 not lock user
+	MaxIPFailures   int64  // failure of one ip in window before lock, default 20, < 0 not lock ip
+	BaseLockTime    int64  // first lock second, it doubles every time locked again, default 60
+	MaxLockTime     int64  // lock second can not over, default 3600
+	ResetLockTime   int64  // lock time back to base when not locked in this second, default 86400
+}
+
+// LoginGuard throttle login attempt by user id and ip, lock them after too many failure in window.
+// It is based on the kv pool, not need the session.
+type LoginGuard struct {
+	pool   *redis.Pool
+	config LoginGuardConfig
+	events *eventHub
+}
+
+// NewLoginGuard new login guard by redis pool
+func NewLoginGuard(pool *redis.Pool, config LoginGuardConfig) (*LoginGuard, error) {
+	if pool == nil {
+		return nil, errors.New("redis pool is nil")
+	}
+
+	return &LoginGuard{pool: pool, config: fixLoginGuardConfig(config), events: newEventHub()}, nil
+}
+
+// NewLoginGuardWithConfig new login guard with redisConf config
+func NewLoginGuardWithConfig(redisConf *kv.MyRedisConf, config LoginGuardConfig) (*LoginGuard, error) {
+	if redisConf == nil {
+		return nil, errors.New("config is nil")
+	}
+
+	pool, err := kv.NewRedis(redisConf)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewLoginGuard(pool, config)
+}
+
+func fixLoginGuardConfig(config LoginGuardConfig) LoginGuardConfig {
+	if config.KeyPrefix == "" {
+		config.KeyPrefix = "gosession-guard"
+	}
+	config.KeyPrefix = strings.Replace(config.KeyPrefix, "_", "-", -1)
+
+	if config.Window <= 0 {
+		config.Window = 900
+	}
+
+	if config.MaxUserFailures == 0 {
+		config.MaxUserFailures = 5
+	}
+
+	if config.MaxIPFailures == 0 {
+		config.MaxIPFailures = 20
+	}
+
+	if config.BaseLockTime <= 0 {
+		config.BaseLockTime = 60
+	}
+
+	if config.MaxLockTime < config.BaseLockTime {
+		config.MaxLockTime = 3600
+		if config.MaxLockTime < config.BaseLockTime {
+			config.MaxLockTime = config.BaseLockTime
+		}
+	}
+
+	if config.ResetLockTime <= 0 {
+		config.ResetLockTime = 3600 * 24
+	}
+
+	return config
+}
+
+// AddEventListener listener receive EventLock and EventUnlock, async will run in its own goroutine
+func (g *LoginGuard) AddEventListener(listener EventListener, async bool) *LoginGuard {
+	g.events.add(listener, async)
+	return g
+}
+
+// Allow can user login from ip now, when not allow retryAfter is how many second the lock remain,
+// empty user id or ip not check
+func (g *LoginGuard) Allow(userId string, ip string) (allow bool, retryAfter int64, err error) {
+	subjects := g.subjects(userId, ip)
+	if len(subjects) == 0 {
+		return false, 0, errors.New("user id and ip empty")
+	}
+
+	conn := g.pool.Get()
+	if conn.Err() != nil {
+		err = conn.Err()
+		return
+	}
+
+	defer func(conn redis.Conn) {
+		err := conn.Close()
+		if err != nil {
+		}
+	}(conn)
+
+	for _, subject := range subjects {
+		err = conn.Send("TTL", g.lockKey(subject.kind, subject.id))
+		if err != nil {
+			return false, 0, err
+		}
+	}
+
+	err = conn.Flush()
+	if err != nil {
+		return false, 0, err
+	}
+
+	unlocked := make([]loginSubject, 0, len(subjects))
+	for _, subject := range subjects {
+		ttl, err := redis.Int64(conn.Receive())
+		if err != nil {
+			return false, 0, err
+		}
+
+		if ttl > retryAfter {
+			retryAfter = ttl
+		} else if ttl < 0 {
+			unlocked = append(unlocked, subject)
+		}
+	}
+
+	// lock gone by expire, the first one see it fire the unlock event
+	for _, subject := range unlocked {
+		deleted, err := redis.Int64(conn.Do("DEL", g.lockedKey(subject.kind, subject.id)))
+		if err != nil {
+			return false, 0, err
+		}
+
+		if deleted > 0 {
+			g.emit(EventUnlock, subject, 0, "expire")
+		}
+	}
+
+	return retryAfter <= 0, retryAfter, nil
+}
+
+// RecordFailure record one failed login, when too many failure user or ip will be locked,
+// locked true and lockTime second return when this failure cause the lock
+func (g *LoginGuard) RecordFailure(userId string, ip string) (locked bool, lockTime int64, err error) {
+	subjects := g.subjects(userId, ip)
+	if len(subjects) == 0 {
+		return false, 0, errors.New("user id and ip empty")
+	}
+
+	conn := g.pool.Get()
+	if conn.Err() != nil {
+		err = conn.Err()
+		return
+	}
+
+	defer func(conn redis.Conn) {
+		err := conn.Close()
+		if err != nil {
+		}
+	}(conn)
+
+	now := time.Now()
+	for _, subject := range subjects {
+		if subject.max < 0 {
+			continue
+		}
+
+		reply, err := redis.Int64s(loginFailureScript.Do(conn,
+			g.failureKey(subject.kind, subject.id), g.lockKey(subject.kind, subject.id),
+			g.lockTimesKey(subject.kind, subject.id), g.lockedKey(subject.kind, subject.id),
+			now.Unix(), g.config.Window, fmt.Sprintf("%d-%s", now.UnixNano(), GetGUID()), subject.max,
+			g.config.BaseLockTime, g.config.MaxLockTime, g.config.ResetLockTime))
+		if err != nil {
+			return false, 0, err
+		}
+
+		if len(reply) != 2 {
+			return false, 0, errors.New("login failure reply wrong")
+		}
+
+		if reply[1] > 0 {
+			locked = true
+			if reply[1] > lockTime {
+				lockTime = reply[1]
+			}
+			g.emit(EventLock, subject, reply[1], fmt.Sprintf("%d failure", reply[0]))
+		}
+	}
+
+	return locked, lockTime, nil
+}
+
+// RecordSuccess record login success, failure of user forget and lock time of user back to base,
+// failure of ip keep, one ip try many user still be locked
+func (g *LoginGuard) RecordSuccess(userId string, ip string) (err error) {
+	if userId == "" {
+		return nil
+	}
+
+	conn := g.pool.Get()
+	if conn.Err() != nil {
+		err = conn.Err()
+		return
+	}
+
+	defer func(conn redis.Conn) {
+		err := conn.Close()
+		if err != nil {
+		}
+	}(conn)
+
+	_, err = conn.Do("DEL", g.failureKey("user", userId), g.lockTimesKey("user", userId))
+	return err
+}
+
+// Reset clear all failure and lock of user and ip by administrator, empty one not reset
+func (g *LoginGuard) Reset(userId string, ip string) (err error) {
+	subjects := g.subjects(userId, ip)
+	if len(subjects) == 0 {
+		return errors.New("user id and ip empty")
+	}
+
+	conn := g.pool.Get()
+	if conn.Err() != nil {
+		err = conn.Err()
+		return
+	}
+
+	defer func(conn redis.Conn) {
+		err := conn.Close()
+		if err != nil {
+		}
+	}(conn)
+
+	for _, subject := range subjects {
+		deleted, err := redis.Int64(conn.Do("DEL", g.lockKey(subject.kind, subject.id)))
+		if err != nil {
+			return err
+		}
+
+		_, err = conn.Do("DEL", g.failureKey(subject.kind, subject.id),
+			g.lockTimesKey(subject.kind, subject.id), g.lockedKey(subject.kind, subject.id))
+		if err != nil {
+			return err
+		}
+
+		if deleted > 0 {
+			g.emit(EventUnlock, subject, 0, "reset")
+		}
+	}
+
+	return nil
+}
+
+// loginSubject who be counted, user or ip
+type loginSubject struct {
+	kind string
+	id   string
+	max  int64
+}
+
+func (g *LoginGuard) subjects(userId string, ip string) []loginSubject {
+	subjects := make([]loginSubject, 0, 2)
+	if userId != "" {
+		subjects = append(subjects, loginSubject{kind: "user", id: userId, max: g.config.MaxUserFailures})
+	}
+
+	if ip != "" {
+		subjects = append(subjects, loginSubject{kind: "ip", id: ip, max: g.config.MaxIPFailures})
+	}
+
+	return subjects
+}
+
+func (g *LoginGuard) emit(eventType EventType, subject loginSubject, ttl int64, reason string) {
+	event := &Event{Type: eventType, TTL: ttl, Reason: reason}
+	if subject.kind == "user" {
+		event.UserId = subject.id
+	} else {
+		event.IP = subject.id
+	}
+	g.events.emit(event)
+}
+
+// sorted set of failure time in window
+func (g *LoginGuard) failureKey(kind string, id string) string {
+	return fmt.Sprintf("%s-fail-%s_%s", g.config.KeyPrefix, kind, id)
+}
+
+// lock key, ttl is remain lock time
+func (g *LoginGuard) lockKey(kind string, id string) string {
+	return fmt.Sprintf("%s-lock-%s_%s", g.config.KeyPrefix, kind, id)
+}
+
+// how many times locked recently, lock time double by it
+func (g *LoginGuard) lockTimesKey(kind string, id string) string {
+	return fmt.Sprintf("%s-lock-times-%s_%s", g.config.KeyPrefix, kind, id)
+}
+
+// mark locked and unlock event not fire yet
+func (g *LoginGuard) lockedKey(kind string, id string) string {
+	return fmt.Sprintf("%s-locked-%s_%s", g.config.KeyPrefix, kind, id)
+}
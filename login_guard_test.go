@@ -0,0 +1,110 @@
+package gosession
+
+import (
+	"testing"
+)
+
+func TestFixLoginGuardConfig(t *testing.T) {
+	config := fixLoginGuardConfig(LoginGuardConfig{KeyPrefix: "my_app", MaxIPFailures: -1})
+	if config.KeyPrefix != "my-app" || config.Window != 900 || config.MaxUserFailures != 5 || config.MaxIPFailures != -1 {
+		t.Fatalf("config wrong: %+v", config)
+	}
+
+	if config.BaseLockTime != 60 || config.MaxLockTime != 3600 || config.ResetLockTime != 3600*24 {
+		t.Fatalf("lock config wrong: %+v", config)
+	}
+
+	config = fixLoginGuardConfig(LoginGuardConfig{BaseLockTime: 7200})
+	if config.MaxLockTime != 7200 {
+		t.Fatalf("max lock time should not less than base, got %d", config.MaxLockTime)
+	}
+
+	if _, err := NewLoginGuard(nil, LoginGuardConfig{}); err == nil {
+		t.Fatal("nil pool should fail")
+	}
+
+	g := &LoginGuard{config: config}
+	if len(g.subjects("", "")) != 0 || len(g.subjects("1", "10.0.0.1")) != 2 {
+		t.Fatal("subjects wrong")
+	}
+}
+
+func TestLoginGuardLockEscalation(t *testing.T) {
+	s := newTestRedisSession(t)
+	g, err := NewLoginGuard(s.pool, LoginGuardConfig{
+		KeyPrefix:       s.tokenKey + "-guard",
+		MaxUserFailures: 2,
+		MaxIPFailures:   -1,
+		BaseLockTime:    10,
+		MaxLockTime:     25,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var locks, unlocks int
+	g.AddEventListener(EventListenerFunc(func(event *Event) {
+		switch event.Type {
+		case EventLock:
+			locks++
+		case EventUnlock:
+			unlocks++
+		}
+	}), false)
+
+	// lock time double every time locked again, not over max
+	for _, want := range []int64{10, 20, 25} {
+		locked, lockTime, err := g.RecordFailure("1", "10.0.0.1")
+		if err != nil || locked {
+			t.Fatalf("first failure should not lock: %v %d %v", locked, lockTime, err)
+		}
+
+		locked, lockTime, err = g.RecordFailure("1", "10.0.0.1")
+		if err != nil || !locked || lockTime != want {
+			t.Fatalf("lock = %v %d %v, want lock %d", locked, lockTime, err, want)
+		}
+
+		allow, retryAfter, err := g.Allow("1", "10.0.0.1")
+		if err != nil || allow || retryAfter <= 0 || retryAfter > want {
+			t.Fatalf("locked user allow = %v %d %v", allow, retryAfter, err)
+		}
+	}
+
+	// ip not counted, other user not locked
+	if allow, _, err := g.Allow("2", "10.0.0.1"); err != nil || !allow {
+		t.Fatalf("other user should allow: %v %v", allow, err)
+	}
+
+	if err = g.Reset("1", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if allow, _, err := g.Allow("1", "10.0.0.1"); err != nil || !allow {
+		t.Fatalf("reset user should allow: %v %v", allow, err)
+	}
+
+	if locks != 3 || unlocks != 1 {
+		t.Fatalf("event lock %d unlock %d, want 3 1", locks, unlocks)
+	}
+
+	// success make lock time back to base
+	if _, _, err = g.RecordFailure("1", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = g.RecordSuccess("1", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if locked, _, _ := g.RecordFailure("1", ""); locked {
+		t.Fatal("failure before success should be forgot")
+	}
+
+	if locked, lockTime, err := g.RecordFailure("1", ""); err != nil || !locked || lockTime != 10 {
+		t.Fatalf("lock after success = %v %d %v, want base", locked, lockTime, err)
+	}
+
+	if err = g.Reset("1", ""); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,136 @@
+package gosession
+
+import (
+	"sync"
+)
+
+// MemoryStore Store in process memory, lost when exit, for test or single instance
+type MemoryStore struct {
+	mu         sync.Mutex
+	tokens     map[string]*StoreToken         // token index
+	userTokens map[string]map[string]struct{} // all token of user
+	users      map[string]*memoryUser         // user info cache
+	clock      Clock                          // where get now, nil means SystemClock
+}
+
+// memoryUser user info cache in memory
+type memoryUser struct {
+	Detail    []byte
+	ExpiresAt int64 // unix second when expire
+}
+
+// NewMemoryStore new an empty memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		tokens:     make(map[string]*StoreToken),
+		userTokens: make(map[string]map[string]struct{}),
+		users:      make(map[string]*memoryUser),
+	}
+}
+
+// PutToken Put token and add it to list of user
+func (m *MemoryStore) PutToken(token *StoreToken) error {
+	t := *token
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.tokens[t.Token] = &t
+	if m.userTokens[t.UserId] == nil {
+		m.userTokens[t.UserId] = make(map[string]struct{})
+	}
+	m.userTokens[t.UserId][t.Token] = struct{}{}
+	return nil
+}
+
+// GetToken Get token, expired one is deleted
+func (m *MemoryStore) GetToken(token string) (*StoreToken, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.tokens[token]
+	if !ok {
+		return nil, false, nil
+	}
+
+	if t.ExpiresAt <= m.now().Unix() {
+		m.deleteToken(t.UserId, token)
+		return nil, false, nil
+	}
+
+	result := *t
+	return &result, true, nil
+}
+
+// DeleteToken Delete token and remove it from list of user
+func (m *MemoryStore) DeleteToken(userId string, token string) error {
+	m.mu.Lock()
+	m.deleteToken(userId, token)
+	m.mu.Unlock()
+	return nil
+}
+
+// lock hold by caller
+func (m *MemoryStore) deleteToken(userId string, token string) {
+	delete(m.tokens, token)
+	delete(m.userTokens[userId], token)
+	if len(m.userTokens[userId]) == 0 {
+		delete(m.userTokens, userId)
+	}
+}
+
+// ListUserToken List all live token of user, expired one is deleted
+func (m *MemoryStore) ListUserToken(userId string) ([]*StoreToken, error) {
+	now := m.now().Unix()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make([]*StoreToken, 0, len(m.userTokens[userId]))
+	for token := range m.userTokens[userId] {
+		t, ok := m.tokens[token]
+		if !ok || t.ExpiresAt <= now {
+			m.deleteToken(userId, token)
+			continue
+		}
+
+		temp := *t
+		result = append(result, &temp)
+	}
+
+	return result, nil
+}
+
+// GetUser Get user info cache
+func (m *MemoryStore) GetUser(userId string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[userId]
+	if !ok {
+		return nil, false, nil
+	}
+
+	if u.ExpiresAt <= m.now().Unix() {
+		delete(m.users, userId)
+		return nil, false, nil
+	}
+
+	return u.Detail, true, nil
+}
+
+// SetUser Set user info cache
+func (m *MemoryStore) SetUser(userId string, detail []byte, expiresAt int64) error {
+	m.mu.Lock()
+	m.users[userId] = &memoryUser{Detail: detail, ExpiresAt: expiresAt}
+	m.mu.Unlock()
+	return nil
+}
+
+// DeleteUser Delete user info cache
+func (m *MemoryStore) DeleteUser(userId string) error {
+	m.mu.Lock()
+	delete(m.users, userId)
+	m.mu.Unlock()
+	return nil
+}
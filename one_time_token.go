@@ -0,0 +1,213 @@
+package gosession
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// OneTimeTokenExpireTimeDefault one time token expire second when ttl not set
+var OneTimeTokenExpireTimeDefault int64 = 60 * 15
+
+// get and delete token at once, remove it from the user set too
+var consumeOneTimeTokenScript = redis.NewScript(2, `
+local value = redis.call('GET', KEYS[1])
+if value then
+	redis.call('DEL', KEYS[1])
+	redis.call('SREM', KEYS[2], ARGV[1])
+end
+return value
+`)
+
+// OneTimeToken single use token info, such password reset, email verify, magic link
+type OneTimeToken struct {
+	UserId     string `json:"user_id"`           // whose token
+	Purpose    string `json:"purpose"`           // what token for, consume with other purpose will not found
+	Payload    string `json:"payload,omitempty"` // anything caller want such the new email
+	CreateTime int64  `json:"create_time"`       // unix second when issue
+}
+
+// IssueOneTimeToken Issue token can only be consumed once for purpose, expire after ttl second, default 15 minutes
+func (s *RedisSession) IssueOneTimeToken(userId string, purpose string, ttl int64, payload string) (token string, err error) {
+	if userId == "" {
+		err = errors.New("user id empty")
+		return
+	}
+
+	if strings.Contains(userId, "_") {
+		err = errors.New("user id can not contain _")
+		return
+	}
+
+	if purpose == "" || strings.Contains(purpose, "_") {
+		err = errors.New("purpose empty or contain _")
+		return
+	}
+
+	if ttl <= 0 {
+		ttl = OneTimeTokenExpireTimeDefault
+	}
+
+	secret := make([]byte, 32)
+	_, err = rand.Read(secret)
+	if err != nil {
+		return
+	}
+
+	token = fmt.Sprintf("%s_%s", userId, hex.EncodeToString(secret))
+	raw, err := json.Marshal(&OneTimeToken{
+		UserId:     userId,
+		Purpose:    purpose,
+		Payload:    payload,
+		CreateTime: s.now().Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	conn := s.pool.Get()
+	if conn.Err() != nil {
+		err = conn.Err()
+		return "", err
+	}
+
+	defer func(conn redis.Conn) {
+		err := conn.Close()
+		if err != nil {
+		}
+	}(conn)
+
+	setKey := s.userOneTimeTokenSetKey(userId, purpose)
+
+	err = conn.Send("MULTI")
+	if err != nil {
+		return "", err
+	}
+
+	err = conn.Send("SETEX", s.oneTimeTokenKey(purpose, token), ttl, raw)
+	if err != nil {
+		return "", err
+	}
+
+	err = conn.Send("SADD", setKey, token)
+	if err != nil {
+		return "", err
+	}
+
+	err = conn.Send("EXPIRE", setKey, TokenMapKeyExpireTime)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = conn.Do("EXEC")
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// ConsumeOneTimeToken Consume token of purpose, it is deleted atomic, so the second consume will not exist
+func (s *RedisSession) ConsumeOneTimeToken(token string, purpose string) (oneTimeToken *OneTimeToken, exist bool, err error) {
+	if token == "" {
+		err = errors.New("token empty")
+		return
+	}
+
+	if purpose == "" || strings.Contains(purpose, "_") {
+		err = errors.New("purpose empty or contain _")
+		return
+	}
+
+	temp := strings.Split(token, "_")
+	if len(temp) != 2 || temp[0] == "" || temp[1] == "" {
+		err = errors.New("token wrong")
+		return
+	}
+
+	conn := s.pool.Get()
+	if conn.Err() != nil {
+		err = conn.Err()
+		return
+	}
+
+	defer func(conn redis.Conn) {
+		err := conn.Close()
+		if err != nil {
+		}
+	}(conn)
+
+	value, err := redis.Bytes(consumeOneTimeTokenScript.Do(conn, s.oneTimeTokenKey(purpose, token), s.userOneTimeTokenSetKey(temp[0], purpose), token))
+	if err == redis.ErrNil {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	oneTimeToken = new(OneTimeToken)
+	err = json.Unmarshal(value, oneTimeToken)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if oneTimeToken.UserId != temp[0] || oneTimeToken.Purpose != purpose {
+		return nil, false, errors.New("token not match")
+	}
+
+	return oneTimeToken, true, nil
+}
+
+// DeleteUserOneTimeToken Delete all outstanding token of user for purpose, such after password changed
+func (s *RedisSession) DeleteUserOneTimeToken(userId string, purpose string) (err error) {
+	if userId == "" {
+		err = errors.New("user id empty")
+		return
+	}
+
+	if purpose == "" || strings.Contains(purpose, "_") {
+		err = errors.New("purpose empty or contain _")
+		return
+	}
+
+	conn := s.pool.Get()
+	if conn.Err() != nil {
+		err = conn.Err()
+		return
+	}
+
+	defer func(conn redis.Conn) {
+		err := conn.Close()
+		if err != nil {
+		}
+	}(conn)
+
+	setKey := s.userOneTimeTokenSetKey(userId, purpose)
+	tokens, err := redis.Strings(conn.Do("SMEMBERS", setKey))
+	if err != nil {
+		return err
+	}
+
+	keys := make([]interface{}, 0, len(tokens)+1)
+	keys = append(keys, setKey)
+	for _, token := range tokens {
+		keys = append(keys, s.oneTimeTokenKey(purpose, token))
+	}
+
+	_, err = conn.Do("DEL", keys...)
+	return err
+}
+
+// gen oneTimeTokenKey, as a key in redis, it's value will be one time token info
+func (s *RedisSession) oneTimeTokenKey(purpose string, token string) string {
+	return fmt.Sprintf("%s-once-%s_%s", s.tokenKey, purpose, token)
+}
+
+// set key which store all one time token of user for purpose
+func (s *RedisSession) userOneTimeTokenSetKey(userId string, purpose string) string {
+	return fmt.Sprintf("%s-once-user-%s_%s", s.tokenKey, purpose, userId)
+}
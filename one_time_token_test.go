@@ -0,0 +1,108 @@
+package gosession
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestOneTimeTokenCheckArgs(t *testing.T) {
+	s := newRedisSession(nil, tokenKeyDefault, userKeyDefault, expireTimeDefault)
+
+	if _, err := s.IssueOneTimeToken("", "reset", 0, ""); err == nil {
+		t.Fatal("user id empty should fail")
+	}
+
+	if _, err := s.IssueOneTimeToken("1", "reset_password", 0, ""); err == nil {
+		t.Fatal("purpose contain _ should fail")
+	}
+
+	if _, _, err := s.ConsumeOneTimeToken("1", "reset"); err == nil {
+		t.Fatal("token wrong should fail")
+	}
+
+	// the same token of other purpose is other key
+	if s.oneTimeTokenKey("reset", "1_a") == s.oneTimeTokenKey("verify", "1_a") {
+		t.Fatal("purpose should be part of key")
+	}
+}
+
+func TestOneTimeTokenConsumeOnce(t *testing.T) {
+	s := newTestRedisSession(t)
+
+	token, err := s.IssueOneTimeToken("1", "reset", 100, "new@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// wrong purpose not found, and not consume it
+	if _, exist, err := s.ConsumeOneTimeToken(token, "verify"); err != nil || exist {
+		t.Fatalf("wrong purpose should not exist: %v %v", exist, err)
+	}
+
+	oneTimeToken, exist, err := s.ConsumeOneTimeToken(token, "reset")
+	if err != nil || !exist {
+		t.Fatalf("consume: %v %v", exist, err)
+	}
+
+	if oneTimeToken.UserId != "1" || oneTimeToken.Purpose != "reset" || oneTimeToken.Payload != "new@example.com" {
+		t.Fatalf("one time token wrong: %+v", oneTimeToken)
+	}
+
+	if _, exist, err = s.ConsumeOneTimeToken(token, "reset"); err != nil || exist {
+		t.Fatalf("second consume should not exist: %v %v", exist, err)
+	}
+
+	// delete all outstanding
+	token1, err := s.IssueOneTimeToken("1", "reset", 100, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token2, err := s.IssueOneTimeToken("1", "reset", 100, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.DeleteUserOneTimeToken("1", "reset"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, token := range []string{token1, token2} {
+		if _, exist, err = s.ConsumeOneTimeToken(token, "reset"); err != nil || exist {
+			t.Fatalf("deleted token should not exist: %v %v", exist, err)
+		}
+	}
+}
+
+func TestOneTimeTokenConsumeConcurrent(t *testing.T) {
+	s := newTestRedisSession(t)
+
+	token, err := s.IssueOneTimeToken("1", "login", 100, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		consumed int64
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, exist, err := s.ConsumeOneTimeToken(token, "login")
+			if err != nil {
+				t.Error(err)
+			}
+			if exist {
+				atomic.AddInt64(&consumed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if consumed != 1 {
+		t.Fatalf("token consumed %d times, want once", consumed)
+	}
+}
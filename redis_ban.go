@@ -0,0 +1,354 @@
+package gosession
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// ErrUserBanned user is banned, use errors.Is to check the *BanError SetToken return
+var ErrUserBanned = errors.New("user banned")
+
+// Ban user can not login until some time
+type Ban struct {
+	UserId     string `json:"user_id"`          // who
+	Until      int64  `json:"until"`            // unix second when ban end, 0 means forever
+	Reason     string `json:"reason,omitempty"` // why
+	CreateTime int64  `json:"create_time"`      // unix second when ban
+}
+
+// BanError error when banned user set token
+type BanError struct {
+	Ban *Ban
+}
+
+func (e *BanError) Error() string {
+	if e.Ban.Reason == "" {
+		return fmt.Sprintf("user %s banned", e.Ban.UserId)
+	}
+	return fmt.Sprintf("user %s banned: %s", e.Ban.UserId, e.Ban.Reason)
+}
+
+// Is make errors.Is(err, ErrUserBanned) work
+func (e *BanError) Is(target error) bool {
+	return target == ErrUserBanned
+}
+
+// ban still work at now
+func (b *Ban) active(now int64) bool {
+	return b != nil && (b.Until == 0 || b.Until > now)
+}
+
+// BanUser ban user until some time, zero time means forever, all token of user deleted with EventBanned,
+// SetToken return *BanError and token check not exist while ban active
+func (s *RedisSession) BanUser(userId string, until time.Time, reason string) (err error) {
+	if userId == "" {
+		err = errors.New("user id empty")
+		return
+	}
+
+	now := s.now().Unix()
+	ban := &Ban{UserId: userId, Reason: reason, CreateTime: now}
+	if !until.IsZero() {
+		ban.Until = until.Unix()
+		if ban.Until <= now {
+			return errors.New("ban until time passed")
+		}
+	}
+
+	raw, err := json.Marshal(ban)
+	if err != nil {
+		return err
+	}
+
+	conn := s.pool.Get()
+	if conn.Err() != nil {
+		err = conn.Err()
+		return
+	}
+
+	defer func(conn redis.Conn) {
+		err := conn.Close()
+		if err != nil {
+		}
+	}(conn)
+
+	err = conn.Send("MULTI")
+	if err != nil {
+		return err
+	}
+
+	if ban.Until == 0 {
+		err = conn.Send("SET", s.banKey(userId), raw)
+		if err == nil {
+			err = conn.Send("ZADD", s.banListKey(), "+inf", userId)
+		}
+	} else {
+		err = conn.Send("SETEX", s.banKey(userId), ban.Until-now, raw)
+		if err == nil {
+			err = conn.Send("ZADD", s.banListKey(), ban.Until, userId)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.Do("EXEC")
+	if err != nil {
+		return err
+	}
+
+	err = s.deleteUserToken(userId, EventBanned, reason)
+	if err != nil {
+		return err
+	}
+
+	// token the user log in as others, and others log in as the user
+	err = s.deleteImpersonationToken(userId, EventBanned, reason)
+	if err != nil {
+		return err
+	}
+
+	return s.deleteTargetImpersonationToken(userId, EventBanned, reason)
+}
+
+// UnbanUser remove the ban of user, not exist not error
+func (s *RedisSession) UnbanUser(userId string) (err error) {
+	if userId == "" {
+		err = errors.New("user id empty")
+		return
+	}
+
+	conn := s.pool.Get()
+	if conn.Err() != nil {
+		err = conn.Err()
+		return
+	}
+
+	defer func(conn redis.Conn) {
+		err := conn.Close()
+		if err != nil {
+		}
+	}(conn)
+
+	err = conn.Send("MULTI")
+	if err != nil {
+		return err
+	}
+
+	err = conn.Send("DEL", s.banKey(userId))
+	if err != nil {
+		return err
+	}
+
+	err = conn.Send("ZREM", s.banListKey(), userId)
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.Do("EXEC")
+	return err
+}
+
+// GetBan get the active ban of user, exist false when not banned
+func (s *RedisSession) GetBan(userId string) (ban *Ban, exist bool, err error) {
+	if userId == "" {
+		err = errors.New("user id empty")
+		return
+	}
+
+	value, _, exist, err := s.get(s.banKey(userId))
+	if err != nil || !exist {
+		return nil, false, err
+	}
+
+	ban, err = parseBan(value)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !ban.active(s.now().Unix()) {
+		return nil, false, nil
+	}
+
+	return ban, true, nil
+}
+
+// ListBans list active ban order by end time, forever one at last, total is how many active ban
+func (s *RedisSession) ListBans(offset int64, limit int64) (bans []*Ban, total int64, err error) {
+	if offset < 0 {
+		offset = 0
+	}
+
+	if limit <= 0 {
+		limit = 100
+	}
+
+	conn := s.pool.Get()
+	if conn.Err() != nil {
+		err = conn.Err()
+		return
+	}
+
+	defer func(conn redis.Conn) {
+		err := conn.Close()
+		if err != nil {
+		}
+	}(conn)
+
+	listKey := s.banListKey()
+
+	// trim ban which end
+	_, err = conn.Do("ZREMRANGEBYSCORE", listKey, "-inf", s.now().Unix())
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total, err = redis.Int64(conn.Do("ZCARD", listKey))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	userIds, err := redis.Strings(conn.Do("ZRANGE", listKey, offset, offset+limit-1))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	bans = make([]*Ban, 0, len(userIds))
+	if len(userIds) == 0 {
+		return bans, total, nil
+	}
+
+	for _, userId := range userIds {
+		err = conn.Send("GET", s.banKey(userId))
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	err = conn.Flush()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for _, userId := range userIds {
+		value, err := redis.Bytes(conn.Receive())
+		if err == redis.ErrNil {
+			// unban at the same time
+			continue
+		} else if err != nil {
+			return nil, 0, err
+		}
+
+		ban, err := parseBan(value)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		ban.UserId = userId
+		bans = append(bans, ban)
+	}
+
+	return bans, total, nil
+}
+
+// get token and its ttl, with the ban of user in one round trip
+func (s *RedisSession) getTokenAndBan(userId string, token string) (value []byte, ttl int64, exist bool, ban *Ban, err error) {
+	conn := s.pool.Get()
+	if conn.Err() != nil {
+		err = conn.Err()
+		return
+	}
+
+	defer func(conn redis.Conn) {
+		err := conn.Close()
+		if err != nil {
+		}
+	}(conn)
+
+	tokenKey := s.hashTokenKey(token)
+
+	err = conn.Send("GET", tokenKey)
+	if err != nil {
+		return nil, 0, false, nil, err
+	}
+
+	err = conn.Send("TTL", tokenKey)
+	if err != nil {
+		return nil, 0, false, nil, err
+	}
+
+	err = conn.Send("GET", s.banKey(userId))
+	if err != nil {
+		return nil, 0, false, nil, err
+	}
+
+	err = conn.Flush()
+	if err != nil {
+		return nil, 0, false, nil, err
+	}
+
+	value, err = redis.Bytes(conn.Receive())
+	if err == redis.ErrNil {
+		exist = false
+	} else if err != nil {
+		return nil, 0, false, nil, err
+	} else {
+		exist = true
+	}
+
+	ttl, err = redis.Int64(conn.Receive())
+	if err != nil {
+		return nil, 0, false, nil, err
+	}
+
+	banValue, err := redis.Bytes(conn.Receive())
+	if err == redis.ErrNil {
+		return value, ttl, exist, nil, nil
+	} else if err != nil {
+		return nil, 0, false, nil, err
+	}
+
+	ban, err = parseBan(banValue)
+	if err != nil {
+		return nil, 0, false, nil, err
+	}
+
+	return value, ttl, exist, ban, nil
+}
+
+// return *BanError when user banned
+func (s *RedisSession) checkBan(userId string) error {
+	ban, exist, err := s.GetBan(userId)
+	if err != nil {
+		return err
+	}
+
+	if exist {
+		return &BanError{Ban: ban}
+	}
+
+	return nil
+}
+
+func parseBan(value []byte) (*Ban, error) {
+	ban := new(Ban)
+	err := json.Unmarshal(value, ban)
+	if err != nil {
+		return nil, err
+	}
+	return ban, nil
+}
+
+// gen banKey, as a key in redis, it's value will be ban info
+func (s *RedisSession) banKey(userId string) string {
+	return fmt.Sprintf("%s-ban_%s", s.tokenKey, userId)
+}
+
+// sorted set of banned user, score is ban end time
+func (s *RedisSession) banListKey() string {
+	return fmt.Sprintf("%s-ban", s.tokenKey)
+}
@@ -0,0 +1,102 @@
+package gosession
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestBanError(t *testing.T) {
+	var err error = &BanError{Ban: &Ban{UserId: "1", Reason: "spam"}}
+	if !errors.Is(err, ErrUserBanned) {
+		t.Fatal("ban error should be ErrUserBanned")
+	}
+
+	if !errors.Is(fmt.Errorf("login: %w", err), ErrUserBanned) {
+		t.Fatal("wrapped ban error should be ErrUserBanned")
+	}
+
+	var banErr *BanError
+	if !errors.As(err, &banErr) || banErr.Ban.Reason != "spam" {
+		t.Fatal("ban error should carry the ban")
+	}
+
+	if err.Error() != "user 1 banned: spam" {
+		t.Fatalf("error message wrong: %s", err.Error())
+	}
+}
+
+func TestBanActive(t *testing.T) {
+	now := time.Now().Unix()
+	var nilBan *Ban
+	if nilBan.active(now) {
+		t.Fatal("nil ban should not active")
+	}
+
+	if !(&Ban{}).active(now) {
+		t.Fatal("forever ban should active")
+	}
+
+	if !(&Ban{Until: now + 10}).active(now) || (&Ban{Until: now}).active(now) {
+		t.Fatal("ban until wrong")
+	}
+
+	s := newRedisSession(nil, tokenKeyDefault, userKeyDefault, expireTimeDefault)
+	if err := s.BanUser("1", time.Now().Add(-time.Second), ""); err == nil {
+		t.Fatal("ban until passed should fail")
+	}
+}
+
+func TestBanUserEvent(t *testing.T) {
+	s := newTestRedisSession(t)
+
+	var banned []*Event
+	s.AddEventListener(EventListenerFunc(func(event *Event) {
+		switch event.Type {
+		case EventBanned:
+			banned = append(banned, event)
+		case EventLogout, EventExpire:
+			t.Errorf("ban should not emit %s", event.Type)
+		}
+	}), false)
+
+	token, err := s.SetToken("1", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// others log in as the user, and the user log in as others
+	target, err := s.SetImpersonationToken("2", "1", 100, "help")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actor, err := s.SetImpersonationToken("1", "3", 100, "help")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.BanUser("1", time.Time{}, "spam"); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = s.UnbanUser("1") }()
+
+	got := map[string]bool{}
+	for _, event := range banned {
+		if event.Reason != "spam" {
+			t.Fatalf("banned event reason wrong: %+v", event)
+		}
+		got[event.Token] = true
+	}
+
+	if len(banned) != 3 || !got[token] || !got[target] || !got[actor] {
+		t.Fatalf("banned event wrong: %d %v", len(banned), got)
+	}
+
+	for _, token := range []string{token, target, actor} {
+		if _, exist, err := s.CheckToken(token); err != nil || exist {
+			t.Fatalf("token of banned user should revoke: %v %v", exist, err)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package gosession
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ErrBindingMismatch token used by client not match the binding
+var ErrBindingMismatch = errors.New("token binding mismatch")
+
+// BindingPolicy what to do when token binding mismatch
+type BindingPolicy int
+
+const (
+	BindingStrict BindingPolicy = iota // reject and emit EventSuspicious
+	BindingWarn                        // emit EventSuspicious but allow
+	BindingIgnore                      // not check
+)
+
+// Binding client fingerprint, empty field not bind
+type Binding struct {
+	IP        string // client ip, when set token it can be CIDR such as 10.0.0.0/8
+	UserAgent string // client user agent, only hash will be stored
+	Custom    string // custom string such device id
+}
+
+// ConfigBindingPolicy config by chain
+// what to do when CheckTokenWithBinding find mismatch, default BindingStrict
+func (s *RedisSession) ConfigBindingPolicy(policy BindingPolicy) TokenManage {
+	s.bindingPolicy = policy
+	return s
+}
+
+// SetTokenWithBinding Set token bind to client fingerprint, expire after some second
+func (s *RedisSession) SetTokenWithBinding(userId string, tokenValidTimes int64, binding *Binding) (token string, err error) {
+	record := new(tokenRecord)
+	if binding != nil {
+		if binding.IP != "" {
+			if _, _, errCIDR := net.ParseCIDR(binding.IP); errCIDR != nil && net.ParseIP(binding.IP) == nil {
+				return "", fmt.Errorf("binding ip wrong: %s", binding.IP)
+			}
+		}
+
+		record.BindIP = binding.IP
+		record.BindUserAgent = hashUserAgent(binding.UserAgent)
+		record.BindCustom = binding.Custom
+	}
+
+	return s.setToken(userId, tokenValidTimes, record)
+}
+
+// CheckTokenWithBinding Check the token like CheckToken, and the client fingerprint presented must match the binding,
+// when mismatch EventSuspicious will emit, and strict policy will return ErrBindingMismatch
+func (s *RedisSession) CheckTokenWithBinding(token string, presented *Binding) (user *User, exist bool, err error) {
+	user, exist, err = s.CheckToken(token)
+	if err != nil || !exist || s.bindingPolicy == BindingIgnore {
+		return user, exist, err
+	}
+
+	reason := user.record.mismatch(presented)
+	if reason == "" {
+		return user, true, nil
+	}
+
+	s.emit(EventSuspicious, user.Id, token, user.TokenRemainLiveTime, reason)
+	if s.bindingPolicy == BindingWarn {
+		return user, true, nil
+	}
+
+	return nil, false, ErrBindingMismatch
+}
+
+// why presented not match the binding, empty means match
+func (r *tokenRecord) mismatch(presented *Binding) string {
+	if r == nil {
+		return ""
+	}
+
+	if presented == nil {
+		presented = new(Binding)
+	}
+
+	if r.BindIP != "" && !matchIP(r.BindIP, presented.IP) {
+		return "ip mismatch"
+	}
+
+	if r.BindUserAgent != "" && r.BindUserAgent != hashUserAgent(presented.UserAgent) {
+		return "user agent mismatch"
+	}
+
+	if r.BindCustom != "" && r.BindCustom != presented.Custom {
+		return "custom mismatch"
+	}
+
+	return ""
+}
+
+// ip equal or in CIDR
+func matchIP(bind string, presented string) bool {
+	ip := net.ParseIP(presented)
+	if ip == nil {
+		return false
+	}
+
+	if strings.Contains(bind, "/") {
+		_, ipNet, err := net.ParseCIDR(bind)
+		if err != nil {
+			return false
+		}
+		return ipNet.Contains(ip)
+	}
+
+	return ip.Equal(net.ParseIP(bind))
+}
+
+func hashUserAgent(userAgent string) string {
+	if userAgent == "" {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(userAgent))
+	return hex.EncodeToString(sum[:])
+}
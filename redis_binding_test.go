@@ -0,0 +1,37 @@
+package gosession
+
+import (
+	"testing"
+)
+
+func TestBindingMismatch(t *testing.T) {
+	record := &tokenRecord{BindIP: "10.0.0.0/8", BindUserAgent: hashUserAgent("curl"), BindCustom: "device1"}
+
+	if reason := record.mismatch(&Binding{IP: "10.1.2.3", UserAgent: "curl", Custom: "device1"}); reason != "" {
+		t.Fatal("should match:", reason)
+	}
+
+	if reason := record.mismatch(&Binding{IP: "192.168.1.1", UserAgent: "curl", Custom: "device1"}); reason != "ip mismatch" {
+		t.Fatal("ip should mismatch:", reason)
+	}
+
+	if reason := record.mismatch(&Binding{IP: "10.1.2.3", UserAgent: "wget", Custom: "device1"}); reason != "user agent mismatch" {
+		t.Fatal("user agent should mismatch:", reason)
+	}
+
+	if reason := record.mismatch(nil); reason == "" {
+		t.Fatal("nothing presented should mismatch")
+	}
+
+	// single ip
+	record = &tokenRecord{BindIP: "::1"}
+	if reason := record.mismatch(&Binding{IP: "0:0:0:0:0:0:0:1"}); reason != "" {
+		t.Fatal("same ip should match:", reason)
+	}
+
+	// not bind
+	record = new(tokenRecord)
+	if reason := record.mismatch(&Binding{IP: "10.1.2.3"}); reason != "" {
+		t.Fatal("not bind should match:", reason)
+	}
+}
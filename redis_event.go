@@ -0,0 +1,313 @@
+package gosession
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/hunterhug/gosession/kv"
+)
+
+var (
+	// EventStreamBlockTime how long one XREADGROUP block
+	EventStreamBlockTime = 5 * time.Second
+	// EventStreamReadCount how many event one XREADGROUP read
+	EventStreamReadCount = 100
+)
+
+// EventHandler handle event from other instance, for stream return nil will ack the event,
+// return error the event will be delivered again when Subscribe restart
+type EventHandler func(event *Event) error
+
+// redisEventPublisher publish session event to redis pub/sub channel or stream
+type redisEventPublisher struct {
+	pool     *redis.Pool
+	channel  string // pub/sub channel
+	stream   string // stream key, first choose if not empty
+	maxLen   int64  // stream keep about max len event
+	group    string // stream consumer group
+	consumer string // stream consumer name in group
+
+	failed  int64                         // how many event publish fail
+	onError func(event *Event, err error) // call when publish fail, nil ignore
+}
+
+// OnEvent publish event, it runs async, error count and pass to onError
+func (p *redisEventPublisher) OnEvent(event *Event) {
+	err := p.publish(event)
+	if err != nil {
+		atomic.AddInt64(&p.failed, 1)
+		if fn := p.onError; fn != nil {
+			fn(event, err)
+		}
+	}
+}
+
+func (p *redisEventPublisher) publish(event *Event) (err error) {
+	raw, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	conn := p.pool.Get()
+	if conn.Err() != nil {
+		return conn.Err()
+	}
+
+	defer func(conn redis.Conn) {
+		err := conn.Close()
+		if err != nil {
+		}
+	}(conn)
+
+	if p.stream != "" {
+		if p.maxLen > 0 {
+			_, err = conn.Do("XADD", p.stream, "MAXLEN", "~", p.maxLen, "*", "event", raw)
+		} else {
+			_, err = conn.Do("XADD", p.stream, "*", "event", raw)
+		}
+	} else {
+		_, err = conn.Do("PUBLISH", p.channel, raw)
+	}
+
+	return err
+}
+
+// ConfigEventChannel config by chain
+// publish session event such login, logout, revoke all, user updated to redis pub/sub channel,
+// other instance can Subscribe it, event may lost when subscriber not online
+func (s *RedisSession) ConfigEventChannel(channel string) TokenManage {
+	p := s.configEventPublisher()
+	p.channel = channel
+	p.stream = ""
+	return s
+}
+
+// ConfigEventStream config by chain
+// publish session event to redis stream which keep about maxLen event, maxLen <= 0 not limit,
+// Subscribe will read it by consumer group, so event not lost when subscriber restart
+func (s *RedisSession) ConfigEventStream(stream string, maxLen int64, group string, consumer string) TokenManage {
+	p := s.configEventPublisher()
+	p.stream = stream
+	p.maxLen = maxLen
+	p.group = group
+	p.consumer = consumer
+	p.channel = ""
+	return s
+}
+
+// ConfigEventErrorFunc config by chain, fn is called in the publish goroutine when event publish to redis fail,
+// config it after ConfigEventChannel or ConfigEventStream
+func (s *RedisSession) ConfigEventErrorFunc(fn func(event *Event, err error)) TokenManage {
+	if s.eventPublisher != nil {
+		s.eventPublisher.onError = fn
+	}
+	return s
+}
+
+// EventPublishFailed how many event publish to redis fail
+func (s *RedisSession) EventPublishFailed() int64 {
+	if s.eventPublisher == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&s.eventPublisher.failed)
+}
+
+// only one publisher
+func (s *RedisSession) configEventPublisher() *redisEventPublisher {
+	if s.eventPublisher == nil {
+		s.eventPublisher = &redisEventPublisher{pool: s.pool}
+		s.events.add(s.eventPublisher, true)
+	}
+	return s.eventPublisher
+}
+
+// Subscribe receive session event publish by all instance until ctx done,
+// it reads the stream if ConfigEventStream, or pub/sub channel if ConfigEventChannel
+func (s *RedisSession) Subscribe(ctx context.Context, handler EventHandler) error {
+	if handler == nil {
+		return errors.New("event handler nil")
+	}
+
+	p := s.eventPublisher
+	if p == nil {
+		return errors.New("event channel or stream not config")
+	}
+
+	if p.stream != "" {
+		return s.subscribeStream(ctx, p.stream, p.group, p.consumer, handler)
+	}
+
+	subscriber := &kv.Subscriber{
+		Pool:     s.pool,
+		Channels: []string{p.channel},
+		OnMessage: func(msg *kv.Message) {
+			event := new(Event)
+			err := json.Unmarshal(msg.Data, event)
+			if err != nil {
+				return
+			}
+
+			err = handler(event)
+			if err != nil {
+			}
+		},
+	}
+
+	return subscriber.Run(ctx)
+}
+
+// read stream by consumer group, reconnect when broken
+func (s *RedisSession) subscribeStream(ctx context.Context, stream, group, consumer string, handler EventHandler) error {
+	if group == "" || consumer == "" {
+		return errors.New("stream group or consumer empty")
+	}
+
+	for {
+		err := s.readStream(ctx, stream, group, consumer, handler)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if err != nil {
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(kv.SubscribeRetryInterval):
+		}
+	}
+}
+
+func (s *RedisSession) readStream(ctx context.Context, stream, group, consumer string, handler EventHandler) (err error) {
+	conn := s.pool.Get()
+	if conn.Err() != nil {
+		err = conn.Err()
+		return
+	}
+
+	defer func(conn redis.Conn) {
+		err := conn.Close()
+		if err != nil {
+		}
+	}(conn)
+
+	// create group when not exist, new group only read new event
+	_, err = conn.Do("XGROUP", "CREATE", stream, group, "$", "MKSTREAM")
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+
+	// first read event which delivered to this consumer but not ack before, page by the last id
+	pending, pendingId := true, "0"
+	for ctx.Err() == nil {
+		id := ">"
+		if pending {
+			id = pendingId
+		}
+
+		reply, err := redis.DoWithTimeout(conn, EventStreamBlockTime+time.Second, "XREADGROUP", "GROUP", group, consumer,
+			"COUNT", EventStreamReadCount, "BLOCK", int64(EventStreamBlockTime/time.Millisecond), "STREAMS", stream, id)
+		if err != nil {
+			return err
+		}
+
+		ids, events, err := parseStreamEvent(reply)
+		if err != nil {
+			return err
+		}
+
+		if pending {
+			if len(ids) == 0 {
+				pending = false
+				continue
+			}
+			pendingId = ids[len(ids)-1]
+		}
+
+		for i, event := range events {
+			// broken event ack too, or it will come again and again
+			if event != nil {
+				err = handler(event)
+				if err != nil {
+					continue
+				}
+			}
+
+			_, err = conn.Do("XACK", stream, group, ids[i])
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// XREADGROUP reply: [[stream, [[id, [field, value, ...]], ...]]], nil when timeout
+func parseStreamEvent(reply interface{}) (ids []string, events []*Event, err error) {
+	if reply == nil {
+		return nil, nil, nil
+	}
+
+	streams, err := redis.Values(reply, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, v := range streams {
+		stream, err := redis.Values(v, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if len(stream) != 2 {
+			return nil, nil, errors.New("stream reply wrong")
+		}
+
+		entries, err := redis.Values(stream[1], nil)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, e := range entries {
+			entry, err := redis.Values(e, nil)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			if len(entry) != 2 {
+				return nil, nil, errors.New("stream entry wrong")
+			}
+
+			id, err := redis.String(entry[0], nil)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			// pending entry may be deleted by MAXLEN, fields will be nil
+			fields, err := redis.StringMap(entry[1], nil)
+			if err != nil && err != redis.ErrNil {
+				return nil, nil, err
+			}
+
+			var event *Event
+			if raw, ok := fields["event"]; ok {
+				event = new(Event)
+				if json.Unmarshal([]byte(raw), event) != nil {
+					event = nil
+				}
+			}
+
+			ids = append(ids, id)
+			events = append(events, event)
+		}
+	}
+
+	return ids, events, nil
+}
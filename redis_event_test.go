@@ -0,0 +1,68 @@
+package gosession
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestParseStreamEvent(t *testing.T) {
+	reply := []interface{}{
+		[]interface{}{
+			[]byte("stream"),
+			[]interface{}{
+				[]interface{}{[]byte("1-0"), []interface{}{[]byte("event"), []byte(`{"type":"login","user_id":"1","token":"1_a"}`)}},
+				[]interface{}{[]byte("2-0"), nil},
+			},
+		},
+	}
+
+	ids, events, err := parseStreamEvent(reply)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if len(ids) != 2 || ids[1] != "2-0" {
+		t.Fatalf("ids wrong: %v", ids)
+	}
+
+	if events[0] == nil || events[0].Type != EventLogin || events[0].Token != "1_a" {
+		t.Fatalf("event wrong: %#v", events[0])
+	}
+
+	// entry trimmed by MAXLEN
+	if events[1] != nil {
+		t.Fatalf("deleted entry should be nil: %#v", events[1])
+	}
+
+	// block timeout
+	ids, _, err = parseStreamEvent(nil)
+	if err != nil || len(ids) != 0 {
+		t.Fatal("timeout reply wrong")
+	}
+}
+
+func TestEventPublishError(t *testing.T) {
+	pool := &redis.Pool{Dial: func() (redis.Conn, error) { return nil, errors.New("redis down") }}
+	s := newRedisSession(pool, tokenKeyDefault, userKeyDefault, expireTimeDefault)
+
+	failed := make(chan error, 1)
+	s.ConfigEventChannel("channel")
+	s.ConfigEventErrorFunc(func(event *Event, err error) { failed <- err })
+
+	s.emit(EventLogin, "1", "1_a", 10, "")
+	select {
+	case err := <-failed:
+		if err == nil || err.Error() != "redis down" {
+			t.Fatalf("error wrong: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("publish error should pass to error func")
+	}
+
+	if n := s.EventPublishFailed(); n != 1 {
+		t.Fatalf("publish fail count %d, want 1", n)
+	}
+}
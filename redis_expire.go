@@ -0,0 +1,118 @@
+package gosession
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/hunterhug/gosession/kv"
+)
+
+// ConfigRedisDB config by chain
+// which db the redis pool use, session new by NewRedisSessionWithPool should config it before ListenTokenExpire
+func (s *RedisSession) ConfigRedisDB(db int) TokenManage {
+	s.redisDB = db
+	return s
+}
+
+// ListenTokenExpire listen token key expire by redis keyspace event until ctx done,
+// the expired token will be removed from user token map at once and EventExpire will emit.
+// It tries to turn on notify-keyspace-events Ex, if redis forbid CONFIG order, you should turn on it yourself.
+// Many instance can listen at the same time, only one of them will emit the event.
+func (s *RedisSession) ListenTokenExpire(ctx context.Context) error {
+	err := s.enableExpireNotify()
+	if err != nil {
+	}
+
+	subscriber := &kv.Subscriber{
+		Pool:     s.pool,
+		Channels: []string{fmt.Sprintf("__keyevent@%d__:expired", s.redisDB)},
+		OnMessage: func(msg *kv.Message) {
+			err := s.onKeyExpire(string(msg.Data))
+			if err != nil {
+			}
+		},
+	}
+
+	return subscriber.Run(ctx)
+}
+
+// add flag E and x to notify-keyspace-events
+func (s *RedisSession) enableExpireNotify() (err error) {
+	conn := s.pool.Get()
+	if conn.Err() != nil {
+		err = conn.Err()
+		return
+	}
+
+	defer func(conn redis.Conn) {
+		err := conn.Close()
+		if err != nil {
+		}
+	}(conn)
+
+	config, err := redis.StringMap(conn.Do("CONFIG", "GET", "notify-keyspace-events"))
+	if err != nil {
+		return err
+	}
+
+	flags := config["notify-keyspace-events"]
+	newFlags := flags
+	if !strings.Contains(newFlags, "E") {
+		newFlags = newFlags + "E"
+	}
+
+	// A is alias of all event include x
+	if !strings.Contains(newFlags, "x") && !strings.Contains(newFlags, "A") {
+		newFlags = newFlags + "x"
+	}
+
+	if newFlags == flags {
+		return nil
+	}
+
+	_, err = conn.Do("CONFIG", "SET", "notify-keyspace-events", newFlags)
+	return err
+}
+
+// key expire, only care token key
+func (s *RedisSession) onKeyExpire(key string) error {
+	userId, token, ok := s.parseExpiredTokenKey(key)
+	if !ok {
+		return nil
+	}
+
+	if s.localCache != nil {
+		s.localCache.deleteToken(token)
+	}
+
+	// impersonation token in map of actor, and map of target
+	deleted, err := s.forgetToken(userId, token)
+	if err != nil {
+		return err
+	}
+
+	if deleted {
+		s.emit(EventExpire, userId, token, 0, "key expire")
+	}
+
+	return nil
+}
+
+// token and its user of the expired key, ok false when it is not token key
+func (s *RedisSession) parseExpiredTokenKey(key string) (userId string, token string, ok bool) {
+	prefix := s.tokenKey + "_"
+	if !strings.HasPrefix(key, prefix) {
+		return "", "", false
+	}
+
+	// token has prefix user id, hash map key which store all token of user has no token inside
+	token = strings.TrimPrefix(key, prefix)
+	temp := strings.Split(token, "_")
+	if len(temp) < 2 || temp[0] == "" {
+		return "", "", false
+	}
+
+	return temp[0], token, true
+}
@@ -0,0 +1,79 @@
+package gosession
+
+import (
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestParseExpiredTokenKey(t *testing.T) {
+	s := newRedisSession(nil, tokenKeyDefault, userKeyDefault, expireTimeDefault)
+	impToken := s.genImpersonationToken("2", "1")
+
+	cases := []struct {
+		key     string
+		userId  string
+		token   string
+		mapKey  string
+		isToken bool
+	}{
+		{s.hashTokenKey("2_a"), "2", "2_a", s.userTokenMapKey("2"), true},
+		{s.hashTokenKey(impToken), "2", impToken, s.impersonationMapKey("1"), true},
+		{s.userTokenMapKey("2"), "", "", "", false},
+		{s.impersonationMapKey("1"), "", "", "", false},
+		{s.hashUserKey("2"), "", "", "", false},
+		{s.hashTokenKey("_a"), "", "", "", false},
+	}
+
+	for _, c := range cases {
+		userId, token, ok := s.parseExpiredTokenKey(c.key)
+		if ok != c.isToken || userId != c.userId || token != c.token {
+			t.Fatalf("parseExpiredTokenKey(%s) = %s %s %v, want %s %s %v", c.key, userId, token, ok, c.userId, c.token, c.isToken)
+		}
+
+		// impersonation token remove from map of actor
+		if ok && s.tokenMapKeyOfToken(token) != c.mapKey {
+			t.Fatalf("map of %s = %s, want %s", token, s.tokenMapKeyOfToken(token), c.mapKey)
+		}
+	}
+}
+
+func TestOnKeyExpireImpersonation(t *testing.T) {
+	s := newTestRedisSession(t)
+
+	expired := 0
+	s.AddEventListener(EventListenerFunc(func(event *Event) {
+		if event.Type == EventExpire {
+			expired++
+		}
+	}), false)
+
+	token, err := s.SetImpersonationToken("1", "2", 100, "help")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// key gone like expire, then the notify come twice
+	conn := s.pool.Get()
+	defer conn.Close()
+	if _, err = conn.Do("DEL", s.hashTokenKey(token)); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err = s.onKeyExpire(s.hashTokenKey(token)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, mapKey := range []string{s.impersonationMapKey("1"), s.impersonationTargetMapKey("2")} {
+		n, err := redis.Int64(conn.Do("HLEN", mapKey))
+		if err != nil || n != 0 {
+			t.Fatalf("map %s should be clean: %d %v", mapKey, n, err)
+		}
+	}
+
+	if expired != 1 {
+		t.Fatalf("expire event %d, want 1", expired)
+	}
+}
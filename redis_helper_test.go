@@ -0,0 +1,21 @@
+package gosession
+
+import (
+	"testing"
+)
+
+// redis session for behavior test, same redis as debug(), skip when not running,
+// every call has its own key prefix so test not conflict
+func newTestRedisSession(t *testing.T) *RedisSession {
+	t.Helper()
+	tm, err := NewRedisSessionSimple("127.0.0.1:6379", 0, "hunterhug")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	prefix := "gosession-test-" + GetGUID()[:8]
+	s := tm.(*RedisSession)
+	s.ConfigTokenKeyPrefix(prefix + "-token")
+	s.ConfigUserKeyPrefix(prefix + "-user")
+	return s
+}
@@ -0,0 +1,420 @@
+package gosession
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// delete user info cache only when token map is gone at that moment, so token set after HGETALL keep its user cache,
+// return -1 when map still exist, or how many user cache deleted
+var janitorEmptyMapScript = redis.NewScript(2, `
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return -1
+end
+if ARGV[1] == "1" then
+	return redis.call("DEL", KEYS[2])
+end
+return 0
+`)
+
+// JanitorConfig config of background janitor which clean orphaned token map entry and user info cache
+type JanitorConfig struct {
+	Interval       time.Duration // run one round every interval, default 1 hour
+	ScanCount      int64         // SCAN COUNT of one batch, default 100
+	BatchInterval  time.Duration // sleep between two batch to limit rate, default 10 ms
+	PruneUserCache bool          // also delete user info cache of user who has no live token
+}
+
+// JanitorStats statistics of janitor run
+type JanitorStats struct {
+	Runs                   int64         `json:"runs"`                      // how many round finished
+	LastStartTime          time.Time     `json:"last_start_time"`           // when last round start
+	LastDuration           time.Duration `json:"last_duration"`             // how long last round cost
+	LastError              string        `json:"last_error,omitempty"`      // last round error
+	LastKeysScanned        int64         `json:"last_keys_scanned"`         // key scanned in last round
+	LastFieldsPruned       int64         `json:"last_fields_pruned"`        // expired token map field deleted in last round
+	LastMapsDeleted        int64         `json:"last_maps_deleted"`         // empty token map deleted in last round
+	LastUserCachesDeleted  int64         `json:"last_user_caches_deleted"`  // user info cache deleted in last round
+	TotalFieldsPruned      int64         `json:"total_fields_pruned"`       // expired token map field deleted in all round
+	TotalMapsDeleted       int64         `json:"total_maps_deleted"`        // empty token map deleted in all round
+	TotalUserCachesDeleted int64         `json:"total_user_caches_deleted"` // user info cache deleted in all round
+}
+
+// redisJanitor background janitor state
+type redisJanitor struct {
+	mu     sync.Mutex
+	run    sync.Mutex // only one round at the same time
+	stats  JanitorStats
+	cancel context.CancelFunc
+}
+
+// StartJanitor start background janitor, SCAN the token map prefix every config.Interval,
+// prune expired field, delete empty map, and optional user info cache of user has no live token,
+// impersonation map of actor and target pruned too.
+// Call it again will restart with new config.
+func (s *RedisSession) StartJanitor(config JanitorConfig) {
+	config = fixJanitorConfig(config)
+
+	j := s.janitor
+	j.mu.Lock()
+	if j.cancel != nil {
+		j.cancel()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	j.cancel = cancel
+	j.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(config.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				_, err := s.runJanitor(ctx, config)
+				if err != nil {
+				}
+			}
+		}
+	}()
+}
+
+// StopJanitor stop background janitor, the running round will stop at next batch
+func (s *RedisSession) StopJanitor() {
+	j := s.janitor
+	j.mu.Lock()
+	if j.cancel != nil {
+		j.cancel()
+		j.cancel = nil
+	}
+	j.mu.Unlock()
+}
+
+// RunJanitor run one round at once, return the stats after it
+func (s *RedisSession) RunJanitor(config JanitorConfig) (JanitorStats, error) {
+	return s.runJanitor(context.Background(), fixJanitorConfig(config))
+}
+
+// JanitorStats statistics of janitor
+func (s *RedisSession) JanitorStats() JanitorStats {
+	j := s.janitor
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.stats
+}
+
+func fixJanitorConfig(config JanitorConfig) JanitorConfig {
+	if config.Interval <= 0 {
+		config.Interval = time.Hour
+	}
+
+	if config.ScanCount <= 0 {
+		config.ScanCount = 100
+	}
+
+	if config.BatchInterval < 0 {
+		config.BatchInterval = 0
+	} else if config.BatchInterval == 0 {
+		config.BatchInterval = 10 * time.Millisecond
+	}
+
+	return config
+}
+
+func (s *RedisSession) runJanitor(ctx context.Context, config JanitorConfig) (JanitorStats, error) {
+	j := s.janitor
+	j.run.Lock()
+	defer j.run.Unlock()
+
+	round := new(JanitorStats)
+	round.LastStartTime = s.now()
+
+	err := s.scan(ctx, escapeGlob(s.tokenKey)+"_*", config, func(conn redis.Conn, key string) error {
+		round.LastKeysScanned++
+		return s.janitorTokenMap(conn, key, config, round)
+	})
+
+	// impersonation token live in map of actor, and index of target, emit expire once by map of actor
+	if err == nil {
+		err = s.scan(ctx, escapeGlob(s.tokenKey)+"-imp_*", config, func(conn redis.Conn, key string) error {
+			round.LastKeysScanned++
+			return s.janitorImpersonationMap(conn, key, true, round)
+		})
+	}
+
+	if err == nil {
+		err = s.scan(ctx, escapeGlob(s.tokenKey)+"-imp-target_*", config, func(conn redis.Conn, key string) error {
+			round.LastKeysScanned++
+			return s.janitorImpersonationMap(conn, key, false, round)
+		})
+	}
+
+	// trim user and token not online
+	if err == nil && s.presenceWindow > 0 {
+		_, err = s.CountActiveSessions()
+		if err == nil {
+			_, err = s.CountOnlineUsers()
+		}
+		s.prunePresenceTouched()
+	}
+
+	if err == nil && config.PruneUserCache {
+		err = s.scan(ctx, escapeGlob(s.userKey)+"_*", config, func(conn redis.Conn, key string) error {
+			round.LastKeysScanned++
+			return s.janitorUserCache(conn, key, round)
+		})
+	}
+
+	round.LastDuration = s.now().Sub(round.LastStartTime)
+	if err != nil {
+		round.LastError = err.Error()
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.stats.Runs++
+	j.stats.LastStartTime = round.LastStartTime
+	j.stats.LastDuration = round.LastDuration
+	j.stats.LastError = round.LastError
+	j.stats.LastKeysScanned = round.LastKeysScanned
+	j.stats.LastFieldsPruned = round.LastFieldsPruned
+	j.stats.LastMapsDeleted = round.LastMapsDeleted
+	j.stats.LastUserCachesDeleted = round.LastUserCachesDeleted
+	j.stats.TotalFieldsPruned += round.LastFieldsPruned
+	j.stats.TotalMapsDeleted += round.LastMapsDeleted
+	j.stats.TotalUserCachesDeleted += round.LastUserCachesDeleted
+	return j.stats, err
+}
+
+// prune one token map, token key has the same prefix, skip it
+func (s *RedisSession) janitorTokenMap(conn redis.Conn, key string, config JanitorConfig, round *JanitorStats) error {
+	userId := strings.TrimPrefix(key, s.tokenKey+"_")
+	if userId == "" || strings.Contains(userId, "_") {
+		return nil
+	}
+
+	tokens, err := redis.StringMap(conn.Do("HGETALL", key))
+	if err != nil {
+		return err
+	}
+
+	now := s.now().Unix()
+	expired := make([]string, 0)
+	for token, expireTime := range tokens {
+		if SI(expireTime) <= now {
+			expired = append(expired, token)
+		}
+	}
+
+	// map has live token, or gone already
+	if len(expired) == 0 || len(expired) < len(tokens) {
+		return s.janitorPruneFields(conn, key, userId, expired, round)
+	}
+
+	err = s.janitorPruneFields(conn, key, userId, expired, round)
+	if err != nil {
+		return err
+	}
+
+	// redis delete the hash after the last HDEL, token set between HGETALL and HDEL keep the map alive,
+	// so check it and prune user cache together by script, never DEL the map
+	prune := "0"
+	if config.PruneUserCache {
+		prune = "1"
+	}
+
+	count, err := redis.Int64(janitorEmptyMapScript.Do(conn, key, s.hashUserKey(userId), prune))
+	if err != nil {
+		return err
+	}
+
+	if count < 0 {
+		return nil
+	}
+
+	round.LastMapsDeleted++
+	round.LastUserCachesDeleted += count
+	return nil
+}
+
+// HDEL expired field one by one in MULTI, emit expire only for field this round really delete
+func (s *RedisSession) janitorPruneFields(conn redis.Conn, key string, userId string, expired []string, round *JanitorStats) error {
+	if len(expired) == 0 {
+		return nil
+	}
+
+	err := conn.Send("MULTI")
+	if err != nil {
+		return err
+	}
+
+	for _, token := range expired {
+		err = conn.Send("HDEL", key, token)
+		if err != nil {
+			return err
+		}
+	}
+
+	counts, err := redis.Int64s(conn.Do("EXEC"))
+	if err != nil {
+		return err
+	}
+
+	for i, token := range expired {
+		if i < len(counts) && counts[i] > 0 {
+			round.LastFieldsPruned++
+			s.emit(EventExpire, userId, token, 0, "janitor")
+		}
+	}
+
+	return nil
+}
+
+// prune expired field of impersonation map, token in it belong to other user, redis delete the empty map itself
+func (s *RedisSession) janitorImpersonationMap(conn redis.Conn, key string, emit bool, round *JanitorStats) error {
+	tokens, err := redis.StringMap(conn.Do("HGETALL", key))
+	if err != nil {
+		return err
+	}
+
+	now := s.now().Unix()
+	expired := make([]string, 0)
+	for token, expireTime := range tokens {
+		if SI(expireTime) <= now {
+			expired = append(expired, token)
+		}
+	}
+
+	if len(expired) == 0 {
+		return nil
+	}
+
+	err = conn.Send("MULTI")
+	if err != nil {
+		return err
+	}
+
+	for _, token := range expired {
+		err = conn.Send("HDEL", key, token)
+		if err != nil {
+			return err
+		}
+	}
+
+	counts, err := redis.Int64s(conn.Do("EXEC"))
+	if err != nil {
+		return err
+	}
+
+	for i, token := range expired {
+		if i >= len(counts) || counts[i] <= 0 {
+			continue
+		}
+
+		round.LastFieldsPruned++
+		if emit {
+			userId, _ := tokenUserId(token)
+			s.emit(EventExpire, userId, token, 0, "janitor")
+		}
+	}
+
+	return nil
+}
+
+// delete user info cache which user has no token map
+func (s *RedisSession) janitorUserCache(conn redis.Conn, key string, round *JanitorStats) error {
+	userId := strings.TrimPrefix(key, s.userKey+"_")
+	if userId == "" || strings.Contains(userId, "_") {
+		return nil
+	}
+
+	exist, err := redis.Bool(conn.Do("EXISTS", s.userTokenMapKey(userId)))
+	if err != nil {
+		return err
+	}
+
+	if exist {
+		return nil
+	}
+
+	count, err := redis.Int64(conn.Do("DEL", key))
+	if err != nil {
+		return err
+	}
+
+	round.LastUserCachesDeleted += count
+	return nil
+}
+
+// help func to SCAN key match pattern, sleep between batch
+func (s *RedisSession) scan(ctx context.Context, match string, config JanitorConfig, fn func(conn redis.Conn, key string) error) (err error) {
+	conn := s.pool.Get()
+	if conn.Err() != nil {
+		err = conn.Err()
+		return
+	}
+
+	defer func(conn redis.Conn) {
+		err := conn.Close()
+		if err != nil {
+		}
+	}(conn)
+
+	cursor := int64(0)
+	for {
+		reply, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", match, "COUNT", config.ScanCount))
+		if err != nil {
+			return err
+		}
+
+		if len(reply) != 2 {
+			return errors.New("scan reply wrong")
+		}
+
+		cursor, err = redis.Int64(reply[0], nil)
+		if err != nil {
+			return err
+		}
+
+		keys, err := redis.Strings(reply[1], nil)
+		if err != nil {
+			return err
+		}
+
+		for _, key := range keys {
+			err = fn(conn, key)
+			if err != nil {
+				return err
+			}
+		}
+
+		if cursor == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(config.BatchInterval):
+		}
+	}
+}
+
+// escape glob meta char of redis MATCH, so prefix match itself only
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		switch c {
+		case '*', '?', '[', ']', '\\':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
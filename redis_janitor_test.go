@@ -0,0 +1,114 @@
+package gosession
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestEscapeGlob(t *testing.T) {
+	for in, want := range map[string]string{
+		"gosession-token": "gosession-token",
+		"a*b?c":           `a\*b\?c`,
+		"[x]":             `\[x\]`,
+		`a\b`:             `a\\b`,
+	} {
+		if got := escapeGlob(in); got != want {
+			t.Fatalf("escapeGlob(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestJanitorTokenMap(t *testing.T) {
+	s := newTestRedisSession(t)
+	s.ConfigGetUserInfoFunc(GetUserInfoFuncDefault)
+
+	var expired int64
+	s.AddEventListener(EventListenerFunc(func(event *Event) {
+		if event.Type == EventExpire && event.Reason == "janitor" {
+			atomic.AddInt64(&expired, 1)
+		}
+	}), false)
+
+	if _, err := s.SetToken("1", 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.AddUser("1", 100); err != nil {
+		t.Fatal(err)
+	}
+
+	live, err := s.SetToken("2", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = s.AddUser("2", 100); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(2100 * time.Millisecond)
+
+	stats, err := s.RunJanitor(JanitorConfig{PruneUserCache: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.LastFieldsPruned != 1 || stats.LastMapsDeleted != 1 || stats.LastUserCachesDeleted != 1 {
+		t.Fatalf("janitor stats wrong: %+v", stats)
+	}
+
+	if n := atomic.LoadInt64(&expired); n != 1 {
+		t.Fatalf("expire event %d, want 1", n)
+	}
+
+	if _, exist, _ := s.CheckToken(live); !exist {
+		t.Fatal("live token should keep")
+	}
+
+	if _, _, exist, _ := s.get(s.hashUserKey("2")); !exist {
+		t.Fatal("user cache of user has live token should keep")
+	}
+
+	// nothing to do again, no event
+	stats, err = s.RunJanitor(JanitorConfig{PruneUserCache: true})
+	if err != nil || stats.LastFieldsPruned != 0 || atomic.LoadInt64(&expired) != 1 {
+		t.Fatalf("second round should prune nothing: %+v %v", stats, err)
+	}
+}
+
+func TestJanitorImpersonationMap(t *testing.T) {
+	s := newTestRedisSession(t)
+
+	var expired int64
+	s.AddEventListener(EventListenerFunc(func(event *Event) {
+		if event.Type == EventExpire && event.Reason == "janitor" {
+			atomic.AddInt64(&expired, 1)
+		}
+	}), false)
+
+	token, err := s.SetImpersonationToken("1", "2", 1, "help")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(2100 * time.Millisecond)
+
+	stats, err := s.RunJanitor(JanitorConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// one field in map of actor, one in index of target, expire event once
+	if stats.LastFieldsPruned != 2 || atomic.LoadInt64(&expired) != 1 {
+		t.Fatalf("janitor stats wrong: %+v, expire event %d", stats, atomic.LoadInt64(&expired))
+	}
+
+	conn := s.pool.Get()
+	defer conn.Close()
+	for _, key := range []string{s.impersonationMapKey("1"), s.impersonationTargetMapKey("2")} {
+		if ok, err := redis.Bool(conn.Do("HEXISTS", key, token)); err != nil || ok {
+			t.Fatalf("expired impersonation token left in %s: %v %v", key, ok, err)
+		}
+	}
+}
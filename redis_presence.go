@@ -0,0 +1,353 @@
+package gosession
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+var (
+	// PresenceDailyKeyExpireTime daily active session count keep how many second
+	PresenceDailyKeyExpireTime int64 = 3600 * 24 * 31
+
+	// PresenceTouchInterval last seen time of token write at most once in this second when check token,
+	// it is capped to half of the presence window, so online one never look offline
+	PresenceTouchInterval int64 = 10
+)
+
+// redisPresence update last seen time of user and token, it listens session event
+type redisPresence struct {
+	s *RedisSession
+}
+
+// OnEvent login and refresh make token active, others make it offline,
+// event of other tenant forward to root skip, user id of tenants may collide
+func (p *redisPresence) OnEvent(event *Event) {
+	if event.TenantId != p.s.tenantId {
+		return
+	}
+
+	var err error
+	switch event.Type {
+	case EventLogin, EventRefresh, EventRotate:
+		err = p.s.touchPresence(event.UserId, event.Token)
+	case EventLogout, EventEvict, EventExpire, EventBanned:
+		err = p.s.removePresence(event.UserId, event.Token)
+	case EventRevokeAll:
+		err = p.s.removePresence(event.UserId, "")
+	}
+
+	if err != nil {
+	}
+}
+
+// ConfigPresence config by chain
+// record last seen time of user and token when SetToken, RefreshToken and CheckToken,
+// the one seen in windowSecond is online, <= 0 disable.
+// Check token write the last seen time at most once in PresenceTouchInterval, hit the local cache or not.
+func (s *RedisSession) ConfigPresence(windowSecond int64) TokenManage {
+	if windowSecond < 0 {
+		windowSecond = 0
+	}
+
+	if windowSecond > 0 && !s.presenceListen {
+		s.events.add(&redisPresence{s: s}, false)
+		s.presenceListen = true
+	}
+
+	s.presenceWindow = windowSecond
+	return s
+}
+
+// CountActiveSessions how many token seen in window
+func (s *RedisSession) CountActiveSessions() (count int64, err error) {
+	return s.countPresence(s.presenceSessionKey())
+}
+
+// CountOnlineUsers how many user seen in window
+func (s *RedisSession) CountOnlineUsers() (count int64, err error) {
+	return s.countPresence(s.presenceUserKey())
+}
+
+// ListOnlineUsers list user seen in window by cursor, first cursor is 0, when next cursor return 0 means finish.
+// limit is a hint, one page may return more or less, even empty.
+func (s *RedisSession) ListOnlineUsers(cursor uint64, limit int64) (userIds []string, nextCursor uint64, err error) {
+	if s.presenceWindow <= 0 {
+		return nil, 0, errors.New("presence not config")
+	}
+
+	if limit <= 0 {
+		limit = 100
+	}
+
+	conn := s.pool.Get()
+	if conn.Err() != nil {
+		err = conn.Err()
+		return
+	}
+
+	defer func(conn redis.Conn) {
+		err := conn.Close()
+		if err != nil {
+		}
+	}(conn)
+
+	reply, err := redis.Values(conn.Do("ZSCAN", s.presenceUserKey(), cursor, "COUNT", limit))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if len(reply) != 2 {
+		return nil, 0, errors.New("zscan reply wrong")
+	}
+
+	nextCursor, err = redis.Uint64(reply[0], nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// member and score
+	members, err := redis.Strings(reply[1], nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	min := s.now().Unix() - s.presenceWindow
+	userIds = make([]string, 0, len(members)/2)
+	for i := 0; i+1 < len(members); i += 2 {
+		if SI(members[i+1]) >= min {
+			userIds = append(userIds, members[i])
+		}
+	}
+
+	return userIds, nextCursor, nil
+}
+
+// IsUserOnline user seen in window
+func (s *RedisSession) IsUserOnline(userId string) (online bool, err error) {
+	if s.presenceWindow <= 0 {
+		return false, errors.New("presence not config")
+	}
+
+	if userId == "" {
+		return false, errors.New("user id empty")
+	}
+
+	conn := s.pool.Get()
+	if conn.Err() != nil {
+		err = conn.Err()
+		return
+	}
+
+	defer func(conn redis.Conn) {
+		err := conn.Close()
+		if err != nil {
+		}
+	}(conn)
+
+	lastSeen, err := redis.Int64(conn.Do("ZSCORE", s.presenceUserKey(), userId))
+	if err == redis.ErrNil {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return lastSeen >= s.now().Unix()-s.presenceWindow, nil
+}
+
+// CountUserSessions how many live token of user
+func (s *RedisSession) CountUserSessions(userId string) (count int64, err error) {
+	tokens, err := s.ListUserToken(userId)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(tokens)), nil
+}
+
+// CountDailyActiveSessions how many token seen in that day, it is approximate count
+func (s *RedisSession) CountDailyActiveSessions(day time.Time) (count int64, err error) {
+	if s.presenceWindow <= 0 {
+		return 0, errors.New("presence not config")
+	}
+
+	conn := s.pool.Get()
+	if conn.Err() != nil {
+		err = conn.Err()
+		return
+	}
+
+	defer func(conn redis.Conn) {
+		err := conn.Close()
+		if err != nil {
+		}
+	}(conn)
+
+	return redis.Int64(conn.Do("PFCOUNT", s.presenceDailyKey(day)))
+}
+
+// trim not online one and count
+func (s *RedisSession) countPresence(key string) (count int64, err error) {
+	if s.presenceWindow <= 0 {
+		return 0, errors.New("presence not config")
+	}
+
+	conn := s.pool.Get()
+	if conn.Err() != nil {
+		err = conn.Err()
+		return
+	}
+
+	defer func(conn redis.Conn) {
+		err := conn.Close()
+		if err != nil {
+		}
+	}(conn)
+
+	_, err = conn.Do("ZREMRANGEBYSCORE", key, "-inf", fmt.Sprintf("(%d", s.now().Unix()-s.presenceWindow))
+	if err != nil {
+		return 0, err
+	}
+
+	return redis.Int64(conn.Do("ZCARD", key))
+}
+
+// update last seen time when check token, write redis at most once in touch interval by this process,
+// support staff log in as the user not make the user online
+func (s *RedisSession) touchPresenceThrottle(user *User, token string) {
+	if s.presenceWindow <= 0 || user == nil || user.ImpersonatorId != "" {
+		return
+	}
+
+	now := s.now().Unix()
+	if last, ok := s.presenceTouched.Load(token); ok && now-last.(int64) < s.presenceTouchInterval() {
+		return
+	}
+
+	err := s.touchPresence(user.Id, token)
+	if err != nil {
+	}
+}
+
+// touch interval, not longer than half of window
+func (s *RedisSession) presenceTouchInterval() int64 {
+	interval := PresenceTouchInterval
+	if interval > s.presenceWindow/2 {
+		interval = s.presenceWindow / 2
+	}
+	return interval
+}
+
+// forget token not seen in window, so the throttle map not grow forever
+func (s *RedisSession) prunePresenceTouched() {
+	min := s.now().Unix() - s.presenceWindow
+	s.presenceTouched.Range(func(token, last interface{}) bool {
+		if last.(int64) < min {
+			s.presenceTouched.Delete(token)
+		}
+		return true
+	})
+}
+
+// update last seen time of user and token
+func (s *RedisSession) touchPresence(userId string, token string) (err error) {
+	if s.presenceWindow <= 0 {
+		return nil
+	}
+
+	s.presenceTouched.Store(token, s.now().Unix())
+
+	conn := s.pool.Get()
+	if conn.Err() != nil {
+		err = conn.Err()
+		return
+	}
+
+	defer func(conn redis.Conn) {
+		err := conn.Close()
+		if err != nil {
+		}
+	}(conn)
+
+	now := s.now()
+	dailyKey := s.presenceDailyKey(now)
+
+	err = conn.Send("ZADD", s.presenceUserKey(), now.Unix(), userId)
+	if err != nil {
+		return err
+	}
+
+	err = conn.Send("ZADD", s.presenceSessionKey(), now.Unix(), token)
+	if err != nil {
+		return err
+	}
+
+	err = conn.Send("PFADD", dailyKey, token)
+	if err != nil {
+		return err
+	}
+
+	err = conn.Send("EXPIRE", dailyKey, PresenceDailyKeyExpireTime)
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.Do("")
+	return err
+}
+
+// token is offline, user is offline too when no live token, token empty means all token of user offline
+func (s *RedisSession) removePresence(userId string, token string) (err error) {
+	if s.presenceWindow <= 0 {
+		return nil
+	}
+
+	conn := s.pool.Get()
+	if conn.Err() != nil {
+		err = conn.Err()
+		return
+	}
+
+	defer func(conn redis.Conn) {
+		err := conn.Close()
+		if err != nil {
+		}
+	}(conn)
+
+	if token != "" {
+		s.presenceTouched.Delete(token)
+		_, err = conn.Do("ZREM", s.presenceSessionKey(), token)
+		if err != nil {
+			return err
+		}
+
+		count, err := redis.Int64(conn.Do("HLEN", s.userTokenMapKey(userId)))
+		if err != nil {
+			return err
+		}
+
+		if count > 0 {
+			return nil
+		}
+	}
+
+	_, err = conn.Do("ZREM", s.presenceUserKey(), userId)
+	return err
+}
+
+// sorted set of user, score is last seen time
+func (s *RedisSession) presenceUserKey() string {
+	return fmt.Sprintf("%s-online-user", s.tokenKey)
+}
+
+// sorted set of token, score is last seen time
+func (s *RedisSession) presenceSessionKey() string {
+	return fmt.Sprintf("%s-online-token", s.tokenKey)
+}
+
+// hyperloglog of token seen in that day
+func (s *RedisSession) presenceDailyKey(day time.Time) string {
+	return fmt.Sprintf("%s-daily-token-%s", s.tokenKey, day.Format("20060102"))
+}
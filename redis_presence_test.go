@@ -0,0 +1,136 @@
+package gosession
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestPresenceTouchThrottle(t *testing.T) {
+	var dials int64
+	pool := &redis.Pool{Dial: func() (redis.Conn, error) {
+		atomic.AddInt64(&dials, 1)
+		return nil, errors.New("no redis")
+	}}
+
+	clock := NewFakeClock(time.Now())
+	s := newRedisSession(pool, tokenKeyDefault, userKeyDefault, expireTimeDefault)
+	s.ConfigClock(clock)
+	s.presenceWindow = 60
+
+	user := &User{Id: "1"}
+	s.touchPresenceThrottle(user, "1_a")
+	s.touchPresenceThrottle(user, "1_a")
+	if n := atomic.LoadInt64(&dials); n != 1 {
+		t.Fatalf("touch in interval should write once, write %d", n)
+	}
+
+	// other token not throttled
+	s.touchPresenceThrottle(user, "1_b")
+	if n := atomic.LoadInt64(&dials); n != 2 {
+		t.Fatalf("other token should write, write %d", n)
+	}
+
+	clock.Advance(time.Duration(PresenceTouchInterval) * time.Second)
+	s.touchPresenceThrottle(user, "1_a")
+	if n := atomic.LoadInt64(&dials); n != 3 {
+		t.Fatalf("touch after interval should write, write %d", n)
+	}
+
+	// impersonation not make user online
+	s.touchPresenceThrottle(&User{Id: "1", ImpersonatorId: "2"}, "1_c")
+	if n := atomic.LoadInt64(&dials); n != 3 {
+		t.Fatalf("impersonation should not write, write %d", n)
+	}
+
+	// forget token not seen in window
+	clock.Advance(61 * time.Second)
+	s.prunePresenceTouched()
+	if _, ok := s.presenceTouched.Load("1_a"); ok {
+		t.Fatal("token not seen in window should be forgot")
+	}
+}
+
+func TestPresenceTouchInterval(t *testing.T) {
+	s := newRedisSession(nil, tokenKeyDefault, userKeyDefault, expireTimeDefault)
+	s.presenceWindow = 6
+	if n := s.presenceTouchInterval(); n != 3 {
+		t.Fatalf("interval should cap to half window, got %d", n)
+	}
+
+	s.presenceWindow = 600
+	if n := s.presenceTouchInterval(); n != PresenceTouchInterval {
+		t.Fatalf("interval = %d, want %d", n, PresenceTouchInterval)
+	}
+}
+
+func TestPresenceLocalCacheHit(t *testing.T) {
+	s := newTestRedisSession(t)
+	s.ConfigPresence(60)
+	s.ConfigLocalCache(100, 60)
+	defer func() { _ = s.Close() }()
+
+	token, err := s.SetToken("1", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err = s.CheckToken(token); err != nil {
+		t.Fatal(err)
+	}
+
+	// remove the seen time, hit cache after interval should write it back
+	conn := s.pool.Get()
+	_, _ = conn.Do("ZREM", s.presenceSessionKey(), token)
+	_ = conn.Close()
+	s.presenceTouched.Delete(token)
+	if _, exist, err := s.CheckToken(token); err != nil || !exist {
+		t.Fatalf("check token: %v %v", exist, err)
+	}
+
+	online, err := s.IsUserOnline("1")
+	if err != nil || !online {
+		t.Fatalf("cache hit should make user online: %v %v", online, err)
+	}
+
+	count, err := s.CountActiveSessions()
+	if err != nil || count != 1 {
+		t.Fatalf("active session = %d %v, want 1", count, err)
+	}
+}
+
+func TestPresenceSkipTenantEvent(t *testing.T) {
+	var dials int64
+	pool := &redis.Pool{Dial: func() (redis.Conn, error) {
+		atomic.AddInt64(&dials, 1)
+		return nil, errors.New("no redis")
+	}}
+
+	s := newRedisSession(pool, tokenKeyDefault, userKeyDefault, expireTimeDefault)
+	s.ConfigPresence(60)
+	view, err := s.forTenant("acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// tenant event forward to root not touch presence of root
+	view.emit(EventLogin, "1", "1_a", 60, "")
+	if n := atomic.LoadInt64(&dials); n != 0 {
+		t.Fatalf("root presence should skip tenant event, write %d", n)
+	}
+
+	// presence of view count its own
+	view.ConfigPresence(60)
+	view.emit(EventLogin, "1", "1_a", 60, "")
+	if n := atomic.LoadInt64(&dials); n != 1 {
+		t.Fatalf("view presence should count tenant event, write %d", n)
+	}
+
+	s.emit(EventLogin, "1", "1_a", 60, "")
+	if n := atomic.LoadInt64(&dials); n != 2 {
+		t.Fatalf("root presence should count root event, write %d", n)
+	}
+}
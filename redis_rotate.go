@@ -0,0 +1,222 @@
+package gosession
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// WatchRetryTimes retry times when token changed by others in transaction
+var WatchRetryTimes = 3
+
+// ConfigRotateGraceTime config by chain
+// old token still work second after RotateToken, so the concurrent request not fail, 0 revoke at once
+func (s *RedisSession) ConfigRotateGraceTime(second int64) TokenManage {
+	if second < 0 {
+		second = 0
+	}
+	s.rotateGraceTime = second
+	return s
+}
+
+// RotateToken issue a new token for the same user atomically, carry over the record of old token,
+// old token will be revoked after the grace time, check or refresh can not keep it live, rotate it again get ErrTokenRotated,
+// use it when privilege change such login, sudo, role change
+func (s *RedisSession) RotateToken(oldToken string, tokenValidTimes int64) (newToken string, err error) {
+	if oldToken == "" {
+		err = errors.New("token empty")
+		return
+	}
+
+	temp := strings.Split(oldToken, "_")
+	if len(temp) < 2 || temp[0] == "" {
+		err = errors.New("token wrong")
+		return
+	}
+
+	if tokenValidTimes <= 0 {
+		tokenValidTimes = s.defaultTokenTTL()
+	}
+
+	userId := temp[0]
+	newToken = s.genToken(userId)
+
+	var ttl int64
+	exist, err := s.watchTokenRecord(userId, oldToken, func(conn redis.Conn, record *tokenRecord, oldTTL int64) error {
+		// only the newest one can rotate
+		if record.RotatedAt > 0 {
+			return ErrTokenRotated
+		}
+
+		tokenMapKey := s.tokenMapKeyOf(userId, record)
+		ttl = s.capTokenTTL(record, tokenValidTimes)
+		if ttl <= 0 {
+			return ErrTokenExpired
+		}
+
+		raw, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+
+		now := s.now().Unix()
+		err = conn.Send("SETEX", s.hashTokenKey(newToken), ttl, raw)
+		if err != nil {
+			return err
+		}
+
+		err = conn.Send("HSET", tokenMapKey, newToken, now+ttl)
+		if err != nil {
+			return err
+		}
+
+		// old one live at most grace time
+		if s.rotateGraceTime <= 0 {
+			err = conn.Send("DEL", s.hashTokenKey(oldToken))
+			if err != nil {
+				return err
+			}
+
+			err = conn.Send("HDEL", tokenMapKey, oldToken)
+			if err != nil {
+				return err
+			}
+		} else {
+			graceTTL := oldTTL
+			if s.rotateGraceTime < graceTTL {
+				graceTTL = s.rotateGraceTime
+			}
+
+			// mark it rotated, so check and refresh not push its expire time out again
+			record.RotatedAt = now
+			record.ReplacedBy = newToken
+			raw, err = json.Marshal(record)
+			if err != nil {
+				return err
+			}
+
+			err = conn.Send("SETEX", s.hashTokenKey(oldToken), graceTTL, raw)
+			if err != nil {
+				return err
+			}
+
+			err = conn.Send("HSET", tokenMapKey, oldToken, now+graceTTL)
+			if err != nil {
+				return err
+			}
+		}
+
+		// refresh can not set it again after it gone, remember it as long as it could live
+		err = conn.Send("SETEX", s.rotatedTokenKey(oldToken), oldTTL, newToken)
+		if err != nil {
+			return err
+		}
+
+		return conn.Send("EXPIRE", tokenMapKey, TokenMapKeyExpireTime)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if !exist {
+		return "", ErrTokenExpired
+	}
+
+	s.events.emit(&Event{Type: EventRotate, UserId: userId, Token: newToken, OldToken: oldToken, TTL: ttl, Reason: "rotate"})
+	return newToken, s.invalidateLocalCache([]string{oldToken}, nil)
+}
+
+// rotated out token was replaced by which one, not exist means not rotated or the old one should expire already
+func (s *RedisSession) tokenReplacedBy(token string) (newToken string, rotated bool, err error) {
+	value, _, rotated, err := s.get(s.rotatedTokenKey(token))
+	if err != nil {
+		return "", false, err
+	}
+
+	return string(value), rotated, nil
+}
+
+// key remember token rotated out, its value is the new token
+func (s *RedisSession) rotatedTokenKey(token string) string {
+	return fmt.Sprintf("%s-rotated_%s", s.tokenKey, token)
+}
+
+// help func to read token record and write in transaction, fn send the write order,
+// it will retry when token changed by others, exist false when token not exist or expire
+func (s *RedisSession) watchTokenRecord(userId string, token string, fn func(conn redis.Conn, record *tokenRecord, ttl int64) error) (exist bool, err error) {
+	conn := s.pool.Get()
+	if conn.Err() != nil {
+		err = conn.Err()
+		return
+	}
+
+	defer func(conn redis.Conn) {
+		err := conn.Close()
+		if err != nil {
+		}
+	}(conn)
+
+	tokenKey := s.hashTokenKey(token)
+	for i := 0; i < WatchRetryTimes; i++ {
+		_, err = conn.Do("WATCH", tokenKey)
+		if err != nil {
+			return false, err
+		}
+
+		value, err := redis.Bytes(conn.Do("GET", tokenKey))
+		if err == redis.ErrNil {
+			_, err = conn.Do("UNWATCH")
+			return false, err
+		} else if err != nil {
+			return false, err
+		}
+
+		ttl, err := redis.Int64(conn.Do("TTL", tokenKey))
+		if err != nil {
+			return false, err
+		}
+
+		if ttl <= 1 {
+			_, err = conn.Do("UNWATCH")
+			return false, err
+		}
+
+		record, err := s.parseTokenRecord(userId, value)
+		if err != nil {
+			_, errUnwatch := conn.Do("UNWATCH")
+			if errUnwatch != nil {
+			}
+			return false, err
+		}
+
+		err = conn.Send("MULTI")
+		if err != nil {
+			return false, err
+		}
+
+		err = fn(conn, record, ttl)
+		if err != nil {
+			_, errDiscard := conn.Do("DISCARD")
+			if errDiscard != nil {
+			}
+			return false, err
+		}
+
+		reply, err := conn.Do("EXEC")
+		if err != nil {
+			return false, err
+		}
+
+		// token changed by others, try again
+		if reply == nil {
+			continue
+		}
+
+		return true, nil
+	}
+
+	return false, errors.New("token changed too many times")
+}
@@ -0,0 +1,76 @@
+package gosession
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSlideTokenSkipRotated(t *testing.T) {
+	s := newRedisSession(nil, tokenKeyDefault, userKeyDefault, expireTimeDefault)
+	s.ConfigExpirePolicy(ExpirePolicy{IdleTimeout: 100, SlideInterval: 1})
+
+	// pool is nil, slide should not touch redis
+	record := &tokenRecord{CreateTime: time.Now().Unix(), RotatedAt: time.Now().Unix(), ReplacedBy: "1_b"}
+	ttl, expireTime, err := s.slideToken("1", "1_a", record, 10, 123)
+	if err != nil || ttl != 10 || expireTime != 123 {
+		t.Fatalf("rotated token should not slide: %d %d %v", ttl, expireTime, err)
+	}
+}
+
+func TestRotateTokenOldDieAfterGrace(t *testing.T) {
+	s := newTestRedisSession(t)
+	s.ConfigExpirePolicy(ExpirePolicy{IdleTimeout: 100, SlideInterval: 1})
+	s.ConfigRotateGraceTime(3)
+
+	oldToken, err := s.SetToken("1", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newToken, err := s.RotateToken(oldToken, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// check in grace time still work, but not push the expire time out
+	time.Sleep(1100 * time.Millisecond)
+	user, exist, err := s.CheckToken(oldToken)
+	if err != nil || !exist {
+		t.Fatalf("old token should work in grace time: %v %v", exist, err)
+	}
+
+	if user.TokenRemainLiveTime > 3 {
+		t.Fatalf("old token should not slide: %d", user.TokenRemainLiveTime)
+	}
+
+	if err = s.RefreshToken(oldToken, 100); err != ErrTokenRotated {
+		t.Fatalf("refresh old token should fail: %v", err)
+	}
+
+	if _, err = s.RotateToken(oldToken, 100); err != ErrTokenRotated {
+		t.Fatalf("rotate old token again should fail: %v", err)
+	}
+
+	time.Sleep(2100 * time.Millisecond)
+	if _, exist, err = s.CheckToken(oldToken); err != nil || exist {
+		t.Fatalf("old token should die after grace time: %v %v", exist, err)
+	}
+
+	// refresh can not set it again
+	if err = s.RefreshToken(oldToken, 100); err != ErrTokenRotated {
+		t.Fatalf("refresh old token after grace should fail: %v", err)
+	}
+
+	if _, exist, err = s.CheckToken(oldToken); err != nil || exist {
+		t.Fatalf("old token should not come back: %v %v", exist, err)
+	}
+
+	if _, exist, err = s.CheckToken(newToken); err != nil || !exist {
+		t.Fatalf("new token should work: %v %v", exist, err)
+	}
+
+	tokens, err := s.ListUserToken("1")
+	if err != nil || len(tokens) != 1 || tokens[0] != newToken {
+		t.Fatalf("list should only have new token: %v %v", tokens, err)
+	}
+}
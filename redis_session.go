@@ -1,12 +1,14 @@
 package gosession
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/gomodule/redigo/redis"
 	"github.com/hunterhug/gosession/kv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -22,9 +24,28 @@ var (
 	TokenMapKeyExpireTime int64 = 3600 * 24 * 30
 )
 
+const (
+	// local cache invalidate message prefix
+	localCacheMessageToken = "token:"
+	localCacheMessageUser  = "user:"
+
+	// value of user miss key, what the load fail is
+	userMissNotFound    = "not_found"
+	userMissErrorPrefix = "error:"
+)
+
 var (
 	// GetUserInfoFuncDefault default get user info func you can choose
 	GetUserInfoFuncDefault GetUserInfoFunc = func(id string) (*User, error) { return &User{Id: id}, nil }
+
+	// ErrUserNotFound GetUserInfoFunc can return it when user not exist, the token check will report not exist
+	ErrUserNotFound = errors.New("user not found")
+
+	// ErrTokenExpired token not exist or live longer than the absolute timeout, can not refresh
+	ErrTokenExpired = errors.New("token expired")
+
+	// ErrTokenRotated token was rotated out by RotateToken, can not rotate or refresh it again
+	ErrTokenRotated = errors.New("token rotated")
 )
 
 // GetUserInfoFunc func get user info from where
@@ -32,12 +53,60 @@ type GetUserInfoFunc func(id string) (*User, error)
 
 // RedisSession session by redis
 type RedisSession struct {
-	pool         *redis.Pool                    // redis pool can single mode or other mode
-	getUserFunc  func(id string) (*User, error) // when not hit cache will get user from this func
-	tokenKey     string                         // prefix of token，default 'got'
-	userKey      string                         // prefix of user info cache ，default 'gou'
-	expireTime   int64                          // token expire how much second，default  7 days
-	isSingleMode bool                           // is single token, new token will destroy other token
+	pool                   *redis.Pool                    // redis pool can single mode or other mode
+	getUserFunc            func(id string) (*User, error) // when not hit cache will get user from this func
+	tokenKey               string                         // prefix of token，default 'got'
+	userKey                string                         // prefix of user info cache ，default 'gou'
+	expireTime             int64                          // token expire how much second，default  7 days
+	isSingleMode           bool                           // is single token, new token will destroy other token
+	userSoftExpireTime     int64                          // user info cache older than this second still return, but reload in background, 0 disable
+	userNegativeExpireTime int64                          // user not found or load error cache this second, 0 disable
+	userRefreshing         *sync.Map                      // user id which is reloading in background
+	localCache             *localCache                    // in process cache of token check result, nil disable
+	localCacheCancel       context.CancelFunc             // stop the invalidate subscriber of local cache
+	localCacheTracking     bool                           // local cache invalidated by redis client tracking, not need publish
+	events                 *eventHub                      // session event listener
+	eventPublisher         *redisEventPublisher           // publish session event to other instance, nil disable
+	redisDB                int                            // which db the pool use, keyspace event need it
+	janitor                *redisJanitor                  // background janitor state
+	presenceWindow         int64                          // token seen in this second is online, 0 disable
+	presenceListen         bool                           // presence listen session event already
+	presenceTouched        *sync.Map                      // token and when last seen time write by this process
+	expirePolicy           ExpirePolicy                   // sliding expiration and absolute lifetime of token
+	rotateGraceTime        int64                          // old token still work second after rotate, default 30
+	bindingPolicy          BindingPolicy                  // what to do when token binding mismatch, default strict
+	apiKeyPrefix           string                         // prefix of new api key, default 'gsk'
+	apiKeyTouched          *sync.Map                      // api key id and when last used time write
+	tenantId               string                         // tenant of this view, empty means root
+	tenants                *sync.Map                      // tenant id and its view, share by root and all view
+	clock                  Clock                          // where get now, nil means SystemClock
+}
+
+// ExpirePolicy sliding expiration with absolute max lifetime of token
+type ExpirePolicy struct {
+	IdleTimeout     int64 // token not check in this second will expire, every check push the expire time out, 0 disable
+	AbsoluteTimeout int64 // token can not live longer than this second from creation, even refresh, 0 not limit
+	SlideInterval   int64 // push the expire time out at most once in this second, avoid write on every check, default IdleTimeout/10
+}
+
+// tokenRecord value of token key, old version only store the user key string
+type tokenRecord struct {
+	UserKey    string `json:"user_key"`              // user info cache key
+	CreateTime int64  `json:"create_time,omitempty"` // unix second when token set, 0 means unknown
+
+	BindIP        string `json:"bind_ip,omitempty"`         // client ip or CIDR token bind to
+	BindUserAgent string `json:"bind_user_agent,omitempty"` // hash of client user agent token bind to
+	BindCustom    string `json:"bind_custom,omitempty"`     // custom fingerprint token bind to
+
+	Scopes []string `json:"scopes,omitempty"` // what token can do, empty means full power of user
+
+	AuthLevel AuthLevel `json:"auth_level,omitempty"` // authentication assurance level, empty means full
+	AuthTime  int64     `json:"auth_time,omitempty"`  // unix second when user last authenticated, 0 means create time
+
+	ImpersonatorId string `json:"impersonator_id,omitempty"` // who log in as the user, such support staff
+
+	RotatedAt  int64  `json:"rotated_at,omitempty"`  // unix second when rotated out, it only live the grace time, can not slide or refresh
+	ReplacedBy string `json:"replaced_by,omitempty"` // new token which replace it
 }
 
 // NewRedisSession new a redis session with redisConf config
@@ -51,7 +120,13 @@ func NewRedisSession(redisConf *kv.MyRedisConf) (TokenManage, error) {
 		return nil, err
 	}
 
-	return NewRedisSessionWithPool(pool)
+	s, err := NewRedisSessionWithPool(pool)
+	if err != nil {
+		return nil, err
+	}
+
+	s.(*RedisSession).redisDB = redisConf.RedisDB
+	return s, nil
 }
 
 // NewRedisSessionSimple new a redis session with simple config
@@ -65,7 +140,23 @@ func NewRedisSessionWithPool(pool *redis.Pool) (TokenManage, error) {
 	if pool == nil {
 		return nil, errors.New("redis pool is nil")
 	}
-	return &RedisSession{pool: pool, tokenKey: tokenKeyDefault, userKey: userKeyDefault, expireTime: expireTimeDefault}, nil
+	return newRedisSession(pool, tokenKeyDefault, userKeyDefault, expireTimeDefault), nil
+}
+
+func newRedisSession(pool *redis.Pool, tokenKey, userKey string, expireTime int64) *RedisSession {
+	return &RedisSession{
+		pool:            pool,
+		tokenKey:        tokenKey,
+		userKey:         userKey,
+		expireTime:      expireTime,
+		userRefreshing:  new(sync.Map),
+		events:          newEventHub(),
+		janitor:         new(redisJanitor),
+		apiKeyTouched:   new(sync.Map),
+		presenceTouched: new(sync.Map),
+		tenants:         new(sync.Map),
+		rotateGraceTime: 30,
+	}
 }
 
 // NewRedisSessionAll new a redis session, config all
@@ -86,7 +177,10 @@ func NewRedisSessionAll(redisConf *kv.MyRedisConf, tokenKey, userKey string, exp
 	if expireTime <= 0 {
 		expireTime = expireTimeDefault
 	}
-	return &RedisSession{pool: pool, tokenKey: tokenKey, userKey: userKey, expireTime: expireTime, getUserFunc: getUserInfoFunc}, nil
+	s := newRedisSession(pool, tokenKey, userKey, expireTime)
+	s.getUserFunc = getUserInfoFunc
+	s.redisDB = redisConf.RedisDB
+	return s, nil
 }
 
 // NewRedisSessionSingleModeConfig redis single mode config
@@ -146,6 +240,149 @@ func (s *RedisSession) ConfigGetUserInfoFunc(fn GetUserInfoFunc) TokenManage {
 	return s
 }
 
+// ConfigUserInfoSoftExpireTime config by chain
+// user info cache older than second will still return, but reload by getUserFunc in background
+func (s *RedisSession) ConfigUserInfoSoftExpireTime(second int64) TokenManage {
+	if second < 0 {
+		second = 0
+	}
+	s.userSoftExpireTime = second
+	return s
+}
+
+// ConfigUserInfoNegativeExpireTime config by chain
+// user not found or getUserFunc error will be cached second, avoid hit the persistent database every time
+func (s *RedisSession) ConfigUserInfoNegativeExpireTime(second int64) TokenManage {
+	if second < 0 {
+		second = 0
+	}
+	s.userNegativeExpireTime = second
+	return s
+}
+
+// ConfigLocalCache config by chain
+// cache token check result in process, at most size entry and each no older than maxStaleSecond,
+// entry will be invalidated across instances by redis pub/sub when DeleteToken, DeleteUserToken, DeleteUser or RefreshUser,
+// every instance share the token key prefix should enable it, size <= 0 or maxStaleSecond <= 0 will disable
+func (s *RedisSession) ConfigLocalCache(size int, maxStaleSecond int64) TokenManage {
+	s.configLocalCache(size, maxStaleSecond, false)
+	return s
+}
+
+// ConfigLocalCacheTracking config by chain
+// same as ConfigLocalCache, but entry invalidated by redis 6 client side caching (CLIENT TRACKING BCAST) on the token and user key prefix,
+// any one modify the key will invalidate, even not use this package, config it after ConfigTokenKeyPrefix and ConfigUserKeyPrefix
+func (s *RedisSession) ConfigLocalCacheTracking(size int, maxStaleSecond int64) TokenManage {
+	s.configLocalCache(size, maxStaleSecond, true)
+	return s
+}
+
+func (s *RedisSession) configLocalCache(size int, maxStaleSecond int64, tracking bool) {
+	if s.localCacheCancel != nil {
+		s.localCacheCancel()
+		s.localCacheCancel = nil
+	}
+
+	if size <= 0 || maxStaleSecond <= 0 {
+		s.localCache = nil
+		s.localCacheTracking = false
+		return
+	}
+
+	cache := newLocalCache(size, time.Duration(maxStaleSecond)*time.Second, s.now)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var run func(ctx context.Context) error
+	if tracking {
+		tokenPrefix, userPrefix := s.tokenKey+"_", s.userKey+"_"
+		prefixes := []string{tokenPrefix}
+		if userPrefix != tokenPrefix {
+			prefixes = append(prefixes, userPrefix)
+		}
+
+		tracker := &kv.Tracker{
+			Pool:     s.pool,
+			Prefixes: prefixes,
+			OnInvalidate: func(keys []string) {
+				// message may lost when disconnect
+				if keys == nil {
+					cache.purge()
+					return
+				}
+
+				for _, key := range keys {
+					s.onLocalCacheTracking(cache, tokenPrefix, userPrefix, key)
+				}
+			},
+		}
+		run = tracker.Run
+	} else {
+		subscriber := &kv.Subscriber{
+			Pool:     s.pool,
+			Channels: []string{s.localCacheChannel()},
+			OnConnect: func(conn redis.Conn) error {
+				// message may lost when disconnect
+				cache.purge()
+				return nil
+			},
+			OnMessage: func(msg *kv.Message) {
+				s.onLocalCacheMessage(cache, string(msg.Data))
+			},
+		}
+		run = subscriber.Run
+	}
+
+	go func() {
+		err := run(ctx)
+		if err != nil {
+		}
+	}()
+
+	s.localCache = cache
+	s.localCacheCancel = cancel
+	s.localCacheTracking = tracking
+}
+
+// Close stop the background goroutine of session, such invalidate subscriber of local cache and janitor,
+// session can still use but local cache disable
+func (s *RedisSession) Close() error {
+	if s.localCacheCancel != nil {
+		s.localCacheCancel()
+		s.localCacheCancel = nil
+	}
+
+	s.localCache = nil
+	s.localCacheTracking = false
+	s.StopJanitor()
+	return nil
+}
+
+// AddEventListener config by chain
+// listener will receive session event such login, logout, when async it will run in its own goroutine
+func (s *RedisSession) AddEventListener(listener EventListener, async bool) TokenManage {
+	s.events.add(listener, async)
+	return s
+}
+
+// ConfigExpirePolicy config by chain
+// token expire time will be pushed out to IdleTimeout when check, and never live longer than AbsoluteTimeout from creation
+func (s *RedisSession) ConfigExpirePolicy(policy ExpirePolicy) TokenManage {
+	if policy.IdleTimeout < 0 {
+		policy.IdleTimeout = 0
+	}
+
+	if policy.AbsoluteTimeout < 0 {
+		policy.AbsoluteTimeout = 0
+	}
+
+	if policy.SlideInterval <= 0 {
+		policy.SlideInterval = policy.IdleTimeout / 10
+	}
+
+	s.expirePolicy = policy
+	return s
+}
+
 // SetSingleMode set single mode, new token will destroy other token
 func (s *RedisSession) SetSingleMode() TokenManage {
 	s.isSingleMode = true
@@ -154,25 +391,43 @@ func (s *RedisSession) SetSingleMode() TokenManage {
 
 // SetToken Set token, expire after some second
 func (s *RedisSession) SetToken(useId string, tokenValidTimes int64) (token string, err error) {
+	return s.setToken(useId, tokenValidTimes, new(tokenRecord))
+}
+
+// set token with record, record such as binding filled by caller
+func (s *RedisSession) setToken(useId string, tokenValidTimes int64, record *tokenRecord) (token string, err error) {
 	// user id can not nil
 	if useId == "" {
 		err = errors.New("user id nil")
 		return
 	}
 
+	// banned user can not login
+	err = s.checkBan(useId)
+	if err != nil {
+		return "", err
+	}
+
 	if tokenValidTimes <= 0 {
-		tokenValidTimes = s.expireTime
+		tokenValidTimes = s.defaultTokenTTL()
 	}
 
 	// gen token by user id, everytime will gen new
 	token = s.genToken(useId)
 
 	// gen user key by user id
-	userKey := s.hashUserKey(useId)
+	record.UserKey = s.hashUserKey(useId)
+	record.CreateTime = s.now().Unix()
+	tokenValidTimes = s.capTokenTTL(record, tokenValidTimes)
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return "", err
+	}
 
-	// if single, destroy other token first
-	if s.isSingleMode {
-		err = s.DeleteUserToken(useId)
+	// if single, destroy other token first, token not full evict others when elevate to full,
+	// so password only login not kick the user out before second factor pass
+	if s.isSingleMode && record.authLevel() == AuthLevelFull {
+		err = s.deleteUserToken(useId, EventEvict, "single mode")
 		if err != nil {
 			return "", err
 		}
@@ -203,14 +458,14 @@ func (s *RedisSession) SetToken(useId string, tokenValidTimes int64) (token stri
 		return "", err
 	}
 
-	err = conn.Send("SETEX", s.hashTokenKey(token), tokenValidTimes, []byte(userKey))
+	err = conn.Send("SETEX", s.hashTokenKey(token), tokenValidTimes, raw)
 	if err != nil {
 		return "", err
 	}
 
 	tokenMapKey := s.userTokenMapKey(useId)
 
-	err = conn.Send("HSET", tokenMapKey, token, time.Now().Unix()+tokenValidTimes)
+	err = conn.Send("HSET", tokenMapKey, token, s.now().Unix()+tokenValidTimes)
 	if err != nil {
 		return "", err
 	}
@@ -221,10 +476,16 @@ func (s *RedisSession) SetToken(useId string, tokenValidTimes int64) (token stri
 	}
 
 	_, err = conn.Do("EXEC")
+	if err != nil {
+		return "", err
+	}
+
+	s.emit(EventLogin, useId, token, tokenValidTimes, "")
 	return token, nil
 }
 
-// RefreshToken Refresh token，token expire will be again after some second
+// RefreshToken Refresh token，token expire will be again after some second,
+// token not exist or expired return ErrTokenExpired, token rotated out return ErrTokenRotated
 func (s *RedisSession) RefreshToken(token string, tokenValidTimes int64) (err error) {
 	if token == "" {
 		err = errors.New("token empty")
@@ -238,51 +499,77 @@ func (s *RedisSession) RefreshToken(token string, tokenValidTimes int64) (err er
 	}
 
 	if tokenValidTimes <= 0 {
-		tokenValidTimes = s.expireTime
+		tokenValidTimes = s.defaultTokenTTL()
 	}
 
 	userId := temp[0]
 
-	conn := s.pool.Get()
-	if conn.Err() != nil {
-		err = conn.Err()
-		return
+	// keep the record in transaction, so concurrent write such rotate not lost
+	ttl := tokenValidTimes
+	exist, err := s.watchTokenRecord(userId, token, func(conn redis.Conn, record *tokenRecord, oldTTL int64) error {
+		// rotated out one die after grace time
+		if record.RotatedAt > 0 {
+			return ErrTokenRotated
+		}
+
+		s.backfillCreateTime(record)
+		ttl = s.capTokenTTL(record, tokenValidTimes)
+		if ttl <= 0 {
+			return ErrTokenExpired
+		}
+
+		return s.sendRefreshToken(conn, userId, token, record, ttl)
+	})
+	if err != nil {
+		return err
 	}
 
-	defer func(conn redis.Conn) {
-		err := conn.Close()
+	// not set it again, the record such level, scopes and binding is gone with it
+	if !exist {
+		// rotated out one gone after grace time, not come back
+		_, rotated, err := s.tokenReplacedBy(token)
 		if err != nil {
+			return err
 		}
-	}(conn)
 
-	err = conn.Send("MULTI")
-	if err != nil {
-		return
+		if rotated {
+			return ErrTokenRotated
+		}
+
+		return ErrTokenExpired
 	}
 
-	userKey := s.hashUserKey(userId)
-	err = conn.Send("SETEX", s.hashTokenKey(token), tokenValidTimes, []byte(userKey))
-	if err != nil {
-		return
+	s.emit(EventRefresh, userId, token, ttl, "")
+	return s.invalidateLocalCache([]string{token}, nil)
+}
+
+// ttl of token when caller not give, idle timeout when set, so sliding still enforce it
+func (s *RedisSession) defaultTokenTTL() int64 {
+	if s.expirePolicy.IdleTimeout > 0 {
+		return s.expirePolicy.IdleTimeout
 	}
+	return s.expireTime
+}
 
-	tokenMapKey := s.userTokenMapKey(userId)
-	err = conn.Send("HSET", tokenMapKey, token, time.Now().Unix()+tokenValidTimes)
+// send the write of refresh in transaction, record and token map
+func (s *RedisSession) sendRefreshToken(conn redis.Conn, userId string, token string, record *tokenRecord, ttl int64) (err error) {
+	raw, err := json.Marshal(record)
 	if err != nil {
-		return
+		return err
 	}
 
-	err = conn.Send("EXPIRE", tokenMapKey, TokenMapKeyExpireTime)
+	err = conn.Send("SETEX", s.hashTokenKey(token), ttl, raw)
 	if err != nil {
-		return
+		return err
 	}
 
-	_, err = conn.Do("EXEC")
+	tokenMapKey := s.tokenMapKeyOf(userId, record)
+	err = conn.Send("HSET", tokenMapKey, token, s.now().Unix()+ttl)
 	if err != nil {
-		return
+		return err
 	}
 
-	return
+	return conn.Send("EXPIRE", tokenMapKey, TokenMapKeyExpireTime)
 }
 
 // DeleteToken Delete token when you do action such logout
@@ -311,10 +598,19 @@ func (s *RedisSession) DeleteToken(token string) (err error) {
 	}(conn)
 
 	userId := temp[0]
-	return s.deleteToken(conn, userId, token)
+	deleted, err := s.deleteToken(conn, userId, token)
+	if err != nil {
+		return err
+	}
+
+	if deleted {
+		s.emit(EventLogout, userId, token, 0, "delete token")
+	}
+
+	return s.invalidateLocalCache([]string{token}, nil)
 }
 
-func (s *RedisSession) deleteToken(conn redis.Conn, userId string, token string) (err error) {
+func (s *RedisSession) deleteToken(conn redis.Conn, userId string, token string) (deleted bool, err error) {
 	if token == "" {
 		err = errors.New("token empty")
 		return
@@ -327,27 +623,67 @@ func (s *RedisSession) deleteToken(conn redis.Conn, userId string, token string)
 
 	err = conn.Send("MULTI")
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	err = conn.Send("DEL", s.hashTokenKey(token))
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	err = conn.Send("HDEL", s.userTokenMapKey(userId), token)
+	err = s.sendForgetToken(conn, userId, token)
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	_, err = conn.Do("EXEC")
-	return err
+	// how many key deleted of each order
+	counts, err := redis.Int64s(conn.Do("EXEC"))
+	if err != nil {
+		return false, err
+	}
+
+	for _, count := range counts {
+		if count > 0 {
+			deleted = true
+		}
+	}
+
+	return deleted, nil
 }
 
 // CheckTokenOrUpdateUser Check the token, when cache database exist return user info directly,
 // others hit the persistent database and save newest user in cache database then return. such redis check, not check load from mysql.
 // you can check user info by that token, if s.getUserFunc == nil do nothing
 func (s *RedisSession) CheckTokenOrUpdateUser(token string, userInfoValidTimes int64) (user *User, exist bool, err error) {
+	cache := s.localCache
+	withDetail := s.getUserFunc != nil && userInfoValidTimes >= 0
+	if cache != nil {
+		if user, ok := cache.get(token, withDetail); ok {
+			s.touchPresenceThrottle(user, token)
+			return user, true, nil
+		}
+	}
+
+	// invalidation during the check make the result stale, not cache it
+	var gen uint64
+	if cache != nil {
+		gen = cache.generation()
+	}
+
+	user, exist, err = s.checkTokenOrUpdateUser(token, userInfoValidTimes, AuthLevelFull)
+	if err == nil && exist {
+		if cache != nil {
+			cache.setIfGeneration(user, withDetail, gen, true)
+		}
+
+		s.touchPresenceThrottle(user, token)
+	}
+
+	return user, exist, err
+}
+
+// token lower than minLevel such pending mfa not exist
+func (s *RedisSession) checkTokenOrUpdateUser(token string, userInfoValidTimes int64, minLevel AuthLevel) (user *User, exist bool, err error) {
 	if token == "" {
 		err = errors.New("token empty")
 		return
@@ -361,30 +697,67 @@ func (s *RedisSession) CheckTokenOrUpdateUser(token string, userInfoValidTimes i
 
 	userId := temp[0]
 
-	// get user key
-	value, ttl, exist, err := s.get(s.hashTokenKey(token))
+	// get user key, and ban of user together
+	value, ttl, exist, ban, err := s.getTokenAndBan(userId, token)
 	if err != nil {
 		return nil, false, err
 	}
 
-	tokenMapKey := s.userTokenMapKey(userId)
+	// every token of banned user invalid
+	if exist && ban.active(s.now().Unix()) {
+		err = s.revokeToken(userId, token, EventBanned, ban.Reason)
+		if err != nil {
+			return nil, false, err
+		}
+
+		return nil, false, nil
+	}
 
 	if !exist || ttl <= 1 {
-		err = s.deleteMap(tokenMapKey, token)
+		deleted, err := s.forgetToken(userId, token)
 		if err != nil {
 			return nil, false, err
 		}
+
+		// first one find it expire
+		if deleted {
+			s.emit(EventExpire, userId, token, 0, "check token")
+		}
 		return nil, false, nil
 	}
 
-	// get user id from user key
-	userKey := string(value)
-	temp = strings.Split(userKey, "_")
-	if len(temp) != 2 || temp[0] != s.userKey || temp[1] != userId {
-		return nil, false, errors.New("user key invalid")
+	// get user key from record
+	record, err := s.parseTokenRecord(userId, value)
+	if err != nil {
+		return nil, false, err
+	}
+
+	userKey := record.UserKey
+
+	// old record not know creation, count absolute timeout from now on
+	if s.expirePolicy.AbsoluteTimeout > 0 && record.CreateTime <= 0 {
+		err = s.saveCreateTime(userId, token, record)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	// live too long
+	if s.capTokenTTL(record, ttl) <= 0 {
+		err = s.expireToken(userId, token, "absolute timeout")
+		if err != nil {
+			return nil, false, err
+		}
+
+		return nil, false, nil
+	}
+
+	// such password passed but mfa not, it is not log in
+	if record.authLevel().rank() < minLevel.rank() {
+		return nil, false, nil
 	}
 
-	expireTime, exist, err := s.hGet(tokenMapKey, token)
+	expireTime, exist, err := s.hGet(s.tokenMapKeyOf(userId, record), token)
 	if err != nil {
 		return nil, false, err
 	}
@@ -393,17 +766,35 @@ func (s *RedisSession) CheckTokenOrUpdateUser(token string, userInfoValidTimes i
 		return nil, false, nil
 	}
 
+	ttl, expireTime, err = s.slideToken(userId, token, record, ttl, expireTime)
+	if err != nil {
+		return nil, false, err
+	}
+
 	if s.getUserFunc == nil || userInfoValidTimes < 0 {
 		user = new(User)
 		user.Id = userId
-		user.TokenRemainLiveTime = ttl
-		user.Token = token
-		user.TokenExpireTime = expireTime
+		s.fillTokenUser(user, token, ttl, expireTime, record)
 		return user, true, nil
 	}
 
+	user, exist, err = s.loadUser(userId, userKey, userInfoValidTimes)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !exist {
+		return nil, false, nil
+	}
+
+	s.fillTokenUser(user, token, ttl, expireTime, record)
+	return user, true, nil
+}
+
+// load user info from cache, when not hit cache load by getUserFunc and put in cache
+func (s *RedisSession) loadUser(userId string, userKey string, userInfoValidTimes int64) (user *User, exist bool, err error) {
 	// get user info by user key
-	value, _, exist, err = s.get(userKey)
+	value, userTTL, exist, err := s.get(userKey)
 	if err != nil {
 		return nil, false, err
 	}
@@ -415,31 +806,191 @@ func (s *RedisSession) CheckTokenOrUpdateUser(token string, userInfoValidTimes i
 		if err != nil {
 			return nil, false, err
 		}
+
+		// too old, return it but reload in background
+		if s.isUserSoftExpire(userTTL, userInfoValidTimes) {
+			s.reloadUser(userId, userInfoValidTimes)
+		}
+
 		user.Id = userId
-		user.TokenRemainLiveTime = ttl
-		user.Token = token
-		user.TokenExpireTime = expireTime
 		return user, true, nil
 	}
 
+	// load fail a moment ago, not hit the persistent database again
+	if s.userNegativeExpireTime > 0 {
+		value, _, exist, err = s.get(s.hashUserMissKey(userId))
+		if err != nil {
+			return nil, false, err
+		}
+
+		if exist {
+			return nil, false, decodeUserMiss(value)
+		}
+	}
+
 	// load user and add into cache
-	user, exist, err = s.AddUser(userId, userInfoValidTimes)
+	return s.AddUser(userId, userInfoValidTimes)
+}
+
+func (s *RedisSession) CheckToken(token string) (user *User, exist bool, err error) {
+	return s.CheckTokenOrUpdateUser(token, -1)
+}
+
+// delete token which should expire, emit event when deleted
+func (s *RedisSession) expireToken(userId string, token string, reason string) (err error) {
+	return s.revokeToken(userId, token, EventExpire, reason)
+}
+
+// delete token, emit event eventType when deleted
+func (s *RedisSession) revokeToken(userId string, token string, eventType EventType, reason string) (err error) {
+	conn := s.pool.Get()
+	if conn.Err() != nil {
+		err = conn.Err()
+		return
+	}
+
+	defer func(conn redis.Conn) {
+		err := conn.Close()
+		if err != nil {
+		}
+	}(conn)
+
+	deleted, err := s.deleteToken(conn, userId, token)
 	if err != nil {
-		return nil, false, err
+		return err
 	}
 
-	if !exist {
-		return nil, false, nil
+	if deleted {
+		s.emit(eventType, userId, token, 0, reason)
 	}
 
+	return s.invalidateLocalCache([]string{token}, nil)
+}
+
+// fill token info into user
+func (s *RedisSession) fillTokenUser(user *User, token string, ttl int64, expireTime int64, record *tokenRecord) {
 	user.TokenRemainLiveTime = ttl
 	user.Token = token
 	user.TokenExpireTime = expireTime
-	return user, true, nil
+	user.Scopes = record.Scopes
+	user.AuthLevel = record.authLevel()
+	user.AuthTime = record.authTime()
+	user.ImpersonatorId = record.ImpersonatorId
+	user.record = record
 }
 
-func (s *RedisSession) CheckToken(token string) (user *User, exist bool, err error) {
-	return s.CheckTokenOrUpdateUser(token, -1)
+// parse value of token key, and check it belongs to user
+func (s *RedisSession) parseTokenRecord(userId string, value []byte) (record *tokenRecord, err error) {
+	record = new(tokenRecord)
+	if len(value) > 0 && value[0] == '{' {
+		err = json.Unmarshal(value, record)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		record.UserKey = string(value)
+	}
+
+	// get user id from user key
+	temp := strings.Split(record.UserKey, "_")
+	if len(temp) != 2 || temp[0] != s.userKey || temp[1] != userId {
+		return nil, errors.New("user key invalid")
+	}
+
+	return record, nil
+}
+
+// old record not know creation, take now as creation when absolute timeout config, report whether filled
+func (s *RedisSession) backfillCreateTime(record *tokenRecord) bool {
+	if s.expirePolicy.AbsoluteTimeout <= 0 || record.CreateTime > 0 {
+		return false
+	}
+
+	record.CreateTime = s.now().Unix()
+	return true
+}
+
+// save creation into old record first time see it, keep its ttl,
+// record changed by others take the creation it has
+func (s *RedisSession) saveCreateTime(userId string, token string, record *tokenRecord) (err error) {
+	_, err = s.watchTokenRecord(userId, token, func(conn redis.Conn, saved *tokenRecord, ttl int64) error {
+		if !s.backfillCreateTime(saved) {
+			record.CreateTime = saved.CreateTime
+			return nil
+		}
+
+		raw, err := json.Marshal(saved)
+		if err != nil {
+			return err
+		}
+
+		record.CreateTime = saved.CreateTime
+		return conn.Send("SETEX", s.hashTokenKey(token), ttl, raw)
+	})
+	return err
+}
+
+// token ttl can not over the absolute timeout from creation, result <= 0 means token live too long
+func (s *RedisSession) capTokenTTL(record *tokenRecord, ttl int64) int64 {
+	if s.expirePolicy.AbsoluteTimeout <= 0 || record.CreateTime <= 0 {
+		return ttl
+	}
+
+	remain := record.CreateTime + s.expirePolicy.AbsoluteTimeout - s.now().Unix()
+	if remain < ttl {
+		return remain
+	}
+
+	return ttl
+}
+
+// sliding expiration, push the token expire time out to idle timeout when it has passed slide interval
+func (s *RedisSession) slideToken(userId string, token string, record *tokenRecord, ttl int64, expireTime int64) (newTTL int64, newExpireTime int64, err error) {
+	policy := s.expirePolicy
+	if policy.IdleTimeout <= 0 || policy.IdleTimeout-ttl < policy.SlideInterval || record.RotatedAt > 0 {
+		return ttl, expireTime, nil
+	}
+
+	newTTL = s.capTokenTTL(record, policy.IdleTimeout)
+	if newTTL <= ttl {
+		return ttl, expireTime, nil
+	}
+
+	conn := s.pool.Get()
+	if conn.Err() != nil {
+		err = conn.Err()
+		return
+	}
+
+	defer func(conn redis.Conn) {
+		err := conn.Close()
+		if err != nil {
+		}
+	}(conn)
+
+	newExpireTime = s.now().Unix() + newTTL
+	err = conn.Send("MULTI")
+	if err != nil {
+		return
+	}
+
+	err = conn.Send("EXPIRE", s.hashTokenKey(token), newTTL)
+	if err != nil {
+		return
+	}
+
+	err = conn.Send("HSET", s.tokenMapKeyOf(userId, record), token, newExpireTime)
+	if err != nil {
+		return
+	}
+
+	_, err = conn.Do("EXEC")
+	if err != nil {
+		return
+	}
+
+	s.emit(EventRefresh, userId, token, newTTL, "sliding")
+	return newTTL, newExpireTime, nil
 }
 
 // AddUser Add the user info to cache，expire after some second
@@ -455,7 +1006,13 @@ func (s *RedisSession) AddUser(userId string, userInfoValidTimes int64) (user *U
 
 	// get user info from outer func
 	user, err = s.getUserFunc(userId)
-	if err != nil {
+	if errors.Is(err, ErrUserNotFound) {
+		err = s.setUserMiss(userId, nil)
+		return nil, false, err
+	} else if err != nil {
+		errMiss := s.setUserMiss(userId, err)
+		if errMiss != nil {
+		}
 		return nil, false, err
 	}
 
@@ -481,9 +1038,92 @@ func (s *RedisSession) AddUser(userId string, userInfoValidTimes int64) (user *U
 		return nil, false, err
 	}
 
+	// load success, forget the miss before
+	if s.userNegativeExpireTime > 0 {
+		err = s.delete(s.hashUserMissKey(userId))
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
 	return user, true, nil
 }
 
+// user info cache live more than soft expire second
+func (s *RedisSession) isUserSoftExpire(userTTL int64, userInfoValidTimes int64) bool {
+	if s.userSoftExpireTime <= 0 {
+		return false
+	}
+
+	// same as set
+	if userInfoValidTimes <= 0 {
+		userInfoValidTimes = s.expireTime
+	}
+
+	return userInfoValidTimes-userTTL >= s.userSoftExpireTime
+}
+
+// reload user info into cache in background, one user only one goroutine at the same time
+func (s *RedisSession) reloadUser(userId string, userInfoValidTimes int64) {
+	if _, loaded := s.userRefreshing.LoadOrStore(userId, struct{}{}); loaded {
+		return
+	}
+
+	go func() {
+		defer s.userRefreshing.Delete(userId)
+
+		_, exist, err := s.AddUser(userId, userInfoValidTimes)
+		if err != nil {
+			// keep the old one
+			return
+		}
+
+		// user is gone, old cache should not return any more
+		if !exist {
+			err = s.DeleteUser(userId)
+			if err != nil {
+			}
+		}
+	}()
+}
+
+// remember user not found or load error for a while, loadErr nil means not found
+func (s *RedisSession) setUserMiss(userId string, loadErr error) error {
+	if s.userNegativeExpireTime <= 0 {
+		return nil
+	}
+
+	return s.set(s.hashUserMissKey(userId), encodeUserMiss(loadErr), s.userNegativeExpireTime)
+}
+
+// value of user miss key, not found and load error has its own marker, so error with empty message not read as not found
+func encodeUserMiss(loadErr error) []byte {
+	if loadErr == nil {
+		return []byte(userMissNotFound)
+	}
+	return []byte(userMissErrorPrefix + loadErr.Error())
+}
+
+// error of user miss key, nil means user not found
+func decodeUserMiss(value []byte) error {
+	v := string(value)
+	if v == userMissNotFound {
+		return nil
+	}
+
+	if strings.HasPrefix(v, userMissErrorPrefix) {
+		v = strings.TrimPrefix(v, userMissErrorPrefix)
+	} else if v == "" {
+		// written by old version, empty means not found
+		return nil
+	}
+
+	if v == "" {
+		v = "load user fail"
+	}
+	return errors.New(v)
+}
+
 // RefreshUser Refresh cache of user info batch
 func (s *RedisSession) RefreshUser(ids []string, userInfoValidTimes int64) (err error) {
 	// very rude
@@ -492,12 +1132,43 @@ func (s *RedisSession) RefreshUser(ids []string, userInfoValidTimes int64) (err
 		if err != nil {
 			return err
 		}
+
+		s.emit(EventUserUpdated, id, "", 0, "refresh user")
 	}
-	return nil
+
+	// cache fill by check not publish, only here and DeleteUser tell others
+	return s.invalidateLocalCache(nil, ids)
 }
 
 // DeleteUserToken Delete all token of this user
 func (s *RedisSession) DeleteUserToken(userId string) (err error) {
+	err = s.deleteUserToken(userId, EventLogout, "delete user token")
+	if err != nil {
+		return err
+	}
+
+	// token the user log in as others, and others log in as the user
+	err = s.deleteImpersonationToken(userId, EventLogout, "delete user token")
+	if err != nil {
+		return err
+	}
+
+	err = s.deleteTargetImpersonationToken(userId, EventLogout, "delete user token")
+	if err != nil {
+		return err
+	}
+
+	s.emit(EventRevokeAll, userId, "", 0, "delete user token")
+	return nil
+}
+
+// delete all token of this user, every token will emit event eventType
+func (s *RedisSession) deleteUserToken(userId string, eventType EventType, reason string) (err error) {
+	return s.deleteUserTokenExcept(userId, "", eventType, reason)
+}
+
+// delete all token of this user but keep one, empty keep delete all
+func (s *RedisSession) deleteUserTokenExcept(userId string, keep string, eventType EventType, reason string) (err error) {
 	if userId == "" {
 		err = errors.New("user id empty")
 		return
@@ -509,6 +1180,16 @@ func (s *RedisSession) DeleteUserToken(userId string) (err error) {
 		return err
 	}
 
+	if keep != "" {
+		others := result[:0]
+		for _, v := range result {
+			if v != keep {
+				others = append(others, v)
+			}
+		}
+		result = others
+	}
+
 	if !exist || len(result) == 0 {
 		return nil
 	}
@@ -542,8 +1223,20 @@ func (s *RedisSession) DeleteUserToken(userId string) (err error) {
 		}
 	}
 
-	_, err = conn.Do("EXEC")
-	return
+	// how many key deleted of each order, HDEL then DEL of every token
+	counts, err := redis.Int64s(conn.Do("EXEC"))
+	if err != nil {
+		return err
+	}
+
+	// token deleted by others at the same time not emit again
+	for i, v := range result {
+		if 2*i+1 < len(counts) && counts[2*i+1] > 0 {
+			s.emit(eventType, userId, v, 0, reason)
+		}
+	}
+
+	return s.invalidateLocalCache(nil, []string{userId})
 }
 
 // ListUserToken List all token in one user
@@ -572,7 +1265,96 @@ func (s *RedisSession) DeleteUser(userId string) (err error) {
 		err = errors.New("user id empty")
 		return
 	}
-	return s.delete(s.hashUserKey(userId))
+	err = s.delete(s.hashUserKey(userId))
+	if err != nil {
+		return err
+	}
+
+	s.emit(EventUserUpdated, userId, "", 0, "delete user")
+	return s.invalidateLocalCache(nil, []string{userId})
+}
+
+// EventDropped how many event dropped because queue of async listener full
+func (s *RedisSession) EventDropped() int64 {
+	return s.events.droppedCount()
+}
+
+// emit session event to listener
+func (s *RedisSession) emit(eventType EventType, userId string, token string, ttl int64, reason string) {
+	s.events.emit(&Event{Type: eventType, UserId: userId, Token: token, TTL: ttl, Reason: reason})
+}
+
+// remove token check result in local cache, and publish to other instance
+func (s *RedisSession) invalidateLocalCache(tokens []string, userIds []string) (err error) {
+	cache := s.localCache
+	if cache == nil {
+		return nil
+	}
+
+	for _, token := range tokens {
+		cache.deleteToken(token)
+	}
+
+	for _, userId := range userIds {
+		cache.deleteUser(userId)
+	}
+
+	// redis will tell others
+	if s.localCacheTracking {
+		return nil
+	}
+
+	conn := s.pool.Get()
+	if conn.Err() != nil {
+		err = conn.Err()
+		return
+	}
+
+	defer func(conn redis.Conn) {
+		err := conn.Close()
+		if err != nil {
+		}
+	}(conn)
+
+	channel := s.localCacheChannel()
+	for _, token := range tokens {
+		err = conn.Send("PUBLISH", channel, localCacheMessageToken+token)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, userId := range userIds {
+		err = conn.Send("PUBLISH", channel, localCacheMessageUser+userId)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = conn.Do("")
+	return err
+}
+
+// message publish by invalidateLocalCache
+func (s *RedisSession) onLocalCacheMessage(cache *localCache, msg string) {
+	if strings.HasPrefix(msg, localCacheMessageToken) {
+		cache.deleteToken(strings.TrimPrefix(msg, localCacheMessageToken))
+	} else if strings.HasPrefix(msg, localCacheMessageUser) {
+		cache.deleteUser(strings.TrimPrefix(msg, localCacheMessageUser))
+	}
+}
+
+// key modified, which tracked by redis client tracking
+func (s *RedisSession) onLocalCacheTracking(cache *localCache, tokenPrefix, userPrefix string, key string) {
+	if strings.HasPrefix(key, tokenPrefix) {
+		// hash map key which store all token of user has no token inside, skip it
+		token := strings.TrimPrefix(key, tokenPrefix)
+		if strings.Contains(token, "_") {
+			cache.deleteToken(token)
+		}
+	} else if strings.HasPrefix(key, userPrefix) {
+		cache.deleteUser(strings.TrimPrefix(key, userPrefix))
+	}
 }
 
 // help func to set redis key which use MULTI order
@@ -620,7 +1402,8 @@ func (s *RedisSession) delete(key string) (err error) {
 	return err
 }
 
-func (s *RedisSession) deleteMap(key, subKey string) (err error) {
+// remove token from the map which store it, token key gone already, deleted true when it was in map
+func (s *RedisSession) forgetToken(userId string, token string) (deleted bool, err error) {
 	conn := s.pool.Get()
 	if conn.Err() != nil {
 		err = conn.Err()
@@ -633,12 +1416,35 @@ func (s *RedisSession) deleteMap(key, subKey string) (err error) {
 		}
 	}(conn)
 
-	_, err = conn.Do("HDEL", key, subKey)
-	return err
+	err = conn.Send("MULTI")
+	if err != nil {
+		return false, err
+	}
+
+	err = s.sendForgetToken(conn, userId, token)
+	if err != nil {
+		return false, err
+	}
+
+	// first one is map which store it
+	counts, err := redis.Int64s(conn.Do("EXEC"))
+	if err != nil {
+		return false, err
+	}
+
+	return len(counts) > 0 && counts[0] > 0, nil
 }
 
-func (s *RedisSession) deleteMapWithConn(conn redis.Conn, key, subKey string) (err error) {
-	_, err = conn.Do("HDEL", key, subKey)
+// send HDEL token from map which store it in transaction, impersonation token also from map of target
+func (s *RedisSession) sendForgetToken(conn redis.Conn, userId string, token string) (err error) {
+	err = conn.Send("HDEL", s.tokenMapKeyOfToken(token), token)
+	if err != nil {
+		return err
+	}
+
+	if tokenActorId(token) != "" {
+		err = conn.Send("HDEL", s.impersonationTargetMapKey(userId), token)
+	}
 	return err
 }
 
@@ -664,11 +1470,24 @@ func (s *RedisSession) getUserTokenMapKeys(mapKey string) (result []string, exis
 
 	result = make([]string, 0, len(keys))
 	for k, v := range keys {
-		if SI(v) <= time.Now().Unix() {
-			err = s.deleteMapWithConn(conn, mapKey, k)
+		if SI(v) <= s.now().Unix() {
+			deleted, err := redis.Int64(conn.Do("HDEL", mapKey, k))
 			if err != nil {
 				return nil, false, err
 			}
+
+			// only the one really delete it emit, token has prefix user id
+			if deleted > 0 {
+				userId := strings.Split(k, "_")[0]
+				if tokenActorId(k) != "" {
+					_, err = conn.Do("HDEL", s.impersonationTargetMapKey(userId), k)
+					if err != nil {
+						return nil, false, err
+					}
+				}
+
+				s.emit(EventExpire, userId, k, 0, "list token")
+			}
 			continue
 		}
 
@@ -748,7 +1567,33 @@ func (s *RedisSession) hashUserKey(userId string) string {
 	return fmt.Sprintf("%s_%s", s.userKey, userId)
 }
 
+// gen hashUserMissKey, as a key in redis, it's value will be the reason why load user fail
+func (s *RedisSession) hashUserMissKey(userId string) string {
+	return fmt.Sprintf("%s-miss_%s", s.userKey, userId)
+}
+
+// pub/sub channel to invalidate local cache
+func (s *RedisSession) localCacheChannel() string {
+	return fmt.Sprintf("%s-invalidate", s.tokenKey)
+}
+
 // hash map key which struct store all token
 func (s *RedisSession) userTokenMapKey(id string) string {
 	return fmt.Sprintf("%s_%s", s.tokenKey, id)
 }
+
+// hash map key which store the token, impersonation token store in map of actor
+func (s *RedisSession) tokenMapKeyOf(userId string, record *tokenRecord) string {
+	if record.ImpersonatorId != "" {
+		return s.impersonationMapKey(record.ImpersonatorId)
+	}
+	return s.userTokenMapKey(userId)
+}
+
+// hash map key which store the token, know it by token when record not at hand such token key gone
+func (s *RedisSession) tokenMapKeyOfToken(token string) string {
+	if actorId := tokenActorId(token); actorId != "" {
+		return s.impersonationMapKey(actorId)
+	}
+	return s.userTokenMapKey(strings.Split(token, "_")[0])
+}
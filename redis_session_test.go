@@ -5,6 +5,7 @@ import (
 	"github.com/gomodule/redigo/redis"
 	"github.com/hunterhug/gosession/kv"
 	"testing"
+	"time"
 )
 
 func debug() redis.Conn {
@@ -72,3 +73,162 @@ func TestWatch(t *testing.T) {
 		fmt.Println("no multi ok")
 	}
 }
+
+func TestParseTokenRecord(t *testing.T) {
+	s := newRedisSession(nil, tokenKeyDefault, userKeyDefault, expireTimeDefault)
+
+	// old version only store user key
+	record, err := s.parseTokenRecord("1", []byte(s.hashUserKey("1")))
+	if err != nil || record.UserKey != s.hashUserKey("1") || record.CreateTime != 0 {
+		t.Fatalf("old record wrong: %#v, %v", record, err)
+	}
+
+	record, err = s.parseTokenRecord("1", []byte(`{"user_key":"gosession-user_1","create_time":100}`))
+	if err != nil || record.CreateTime != 100 {
+		t.Fatalf("record wrong: %#v, %v", record, err)
+	}
+
+	// token of other user
+	_, err = s.parseTokenRecord("2", []byte(s.hashUserKey("1")))
+	if err == nil {
+		t.Fatal("user key should invalid")
+	}
+}
+
+func TestCapTokenTTL(t *testing.T) {
+	s := newRedisSession(nil, tokenKeyDefault, userKeyDefault, expireTimeDefault)
+	s.ConfigExpirePolicy(ExpirePolicy{IdleTimeout: 100, AbsoluteTimeout: 1000})
+
+	if s.expirePolicy.SlideInterval != 10 {
+		t.Fatal("slide interval default wrong:", s.expirePolicy.SlideInterval)
+	}
+
+	now := time.Now().Unix()
+	if ttl := s.capTokenTTL(&tokenRecord{CreateTime: now}, 100); ttl != 100 {
+		t.Fatal("ttl should not cap:", ttl)
+	}
+
+	if ttl := s.capTokenTTL(&tokenRecord{CreateTime: now - 950}, 100); ttl > 50 {
+		t.Fatal("ttl should cap by absolute timeout:", ttl)
+	}
+
+	if ttl := s.capTokenTTL(&tokenRecord{CreateTime: now - 1000}, 100); ttl > 0 {
+		t.Fatal("token should live too long:", ttl)
+	}
+
+	// unknown creation
+	if ttl := s.capTokenTTL(&tokenRecord{}, 100); ttl != 100 {
+		t.Fatal("old record should not cap:", ttl)
+	}
+}
+
+func TestDefaultTokenTTL(t *testing.T) {
+	s := newRedisSession(nil, tokenKeyDefault, userKeyDefault, expireTimeDefault)
+	if s.defaultTokenTTL() != expireTimeDefault {
+		t.Fatal("default ttl without policy should be expire time:", s.defaultTokenTTL())
+	}
+
+	// refresh with 0 same as set, or sliding never cut it by idle timeout
+	s.ConfigExpirePolicy(ExpirePolicy{IdleTimeout: 100})
+	if s.defaultTokenTTL() != 100 {
+		t.Fatal("default ttl should be idle timeout:", s.defaultTokenTTL())
+	}
+}
+
+func TestBackfillCreateTime(t *testing.T) {
+	s := newRedisSession(nil, tokenKeyDefault, userKeyDefault, expireTimeDefault)
+
+	record := new(tokenRecord)
+	if s.backfillCreateTime(record) || record.CreateTime != 0 {
+		t.Fatal("no absolute timeout should not fill")
+	}
+
+	s.ConfigExpirePolicy(ExpirePolicy{IdleTimeout: 100, AbsoluteTimeout: 1000})
+	if !s.backfillCreateTime(record) || record.CreateTime == 0 {
+		t.Fatal("old record should fill creation")
+	}
+
+	created := record.CreateTime - 10
+	record.CreateTime = created
+	if s.backfillCreateTime(record) || record.CreateTime != created {
+		t.Fatal("known creation should not change")
+	}
+}
+
+func TestLegacyRecordAbsoluteTimeout(t *testing.T) {
+	s := newTestRedisSession(t)
+	clock := NewFakeClock(time.Now())
+	s.ConfigClock(clock)
+	s.ConfigExpirePolicy(ExpirePolicy{IdleTimeout: 100, AbsoluteTimeout: 200, SlideInterval: 1})
+
+	// old version only store the user key string
+	token := s.genToken("1")
+	conn := s.pool.Get()
+	defer conn.Close()
+	_, err := conn.Do("SETEX", s.hashTokenKey(token), 100, s.hashUserKey("1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.Do("HSET", s.userTokenMapKey("1"), token, clock.Now().Unix()+100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, exist, err := s.CheckToken(token); err != nil || !exist {
+		t.Fatalf("check old token: %v %v", exist, err)
+	}
+
+	value, err := redis.Bytes(conn.Do("GET", s.hashTokenKey(token)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	record, err := s.parseTokenRecord("1", value)
+	if err != nil || record.CreateTime != clock.Now().Unix() {
+		t.Fatalf("creation should fill at first check: %+v %v", record, err)
+	}
+
+	// absolute timeout count from the first check, sliding can not keep it forever
+	clock.Advance(201 * time.Second)
+	if err = s.RefreshToken(token, 100); err != ErrTokenExpired {
+		t.Fatalf("refresh after absolute timeout should fail: %v", err)
+	}
+
+	if _, exist, err := s.CheckToken(token); err != nil || exist {
+		t.Fatalf("old token should expire after absolute timeout: %v %v", exist, err)
+	}
+}
+
+func TestRefreshTokenKeepRecord(t *testing.T) {
+	s := newTestRedisSession(t)
+
+	token, err := s.SetTokenWithScopes("1", 100, []string{"read"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.RefreshToken(token, 1000); err != nil {
+		t.Fatal(err)
+	}
+
+	user, exist, err := s.CheckToken(token)
+	if err != nil || !exist {
+		t.Fatalf("check token: %v %v", exist, err)
+	}
+
+	if user.TokenRemainLiveTime <= 100 || len(user.Scopes) != 1 || user.Scopes[0] != "read" {
+		t.Fatalf("refresh should keep record and push ttl: %+v", user)
+	}
+	// logged out one can not come back without its record
+	if err = s.DeleteToken(token); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.RefreshToken(token, 1000); err != ErrTokenExpired {
+		t.Fatalf("refresh deleted token should fail: %v", err)
+	}
+
+	if _, exist, err = s.CheckToken(token); err != nil || exist {
+		t.Fatalf("deleted token should not come back: %v %v", exist, err)
+	}
+}
@@ -0,0 +1,261 @@
+package gosession
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// default key prefix of RedisStore
+var redisStorePrefixDefault = tokenKeyDefault + "-store"
+
+// RedisStore Store in redis, token in string key {prefix}_{token}, token list of user in hash {prefix}-user_{userId},
+// user info cache in {prefix}-info_{userId}, all expire by redis ttl.
+// The layout is not the same as RedisSession, never share one prefix with it
+type RedisStore struct {
+	pool   *redis.Pool
+	prefix string
+	clock  Clock // where get now, nil means SystemClock
+}
+
+// NewRedisStore new a redis store, prefix empty will use default one not conflict with RedisSession
+func NewRedisStore(pool *redis.Pool, prefix string) (*RedisStore, error) {
+	if pool == nil {
+		return nil, errors.New("redis pool is nil")
+	}
+
+	if prefix == "" {
+		prefix = redisStorePrefixDefault
+	}
+
+	return &RedisStore{pool: pool, prefix: prefix}, nil
+}
+
+// PutToken Put token and add it to list of user in one MULTI, expired one return ErrTokenExpired
+func (r *RedisStore) PutToken(token *StoreToken) (err error) {
+	ttl := token.ExpiresAt - r.now().Unix()
+	if ttl <= 0 {
+		return ErrTokenExpired
+	}
+
+	raw, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+
+	conn := r.pool.Get()
+	if conn.Err() != nil {
+		err = conn.Err()
+		return
+	}
+
+	defer func(conn redis.Conn) {
+		err := conn.Close()
+		if err != nil {
+		}
+	}(conn)
+
+	userKey := r.userTokenKey(token.UserId)
+
+	err = conn.Send("MULTI")
+	if err != nil {
+		return err
+	}
+
+	err = conn.Send("SETEX", r.tokenKey(token.Token), ttl, raw)
+	if err != nil {
+		return err
+	}
+
+	err = conn.Send("HSET", userKey, token.Token, raw)
+	if err != nil {
+		return err
+	}
+
+	err = conn.Send("EXPIRE", userKey, TokenMapKeyExpireTime)
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.Do("EXEC")
+	return err
+}
+
+// GetToken Get token
+func (r *RedisStore) GetToken(token string) (*StoreToken, bool, error) {
+	raw, err := r.get(r.tokenKey(token))
+	if err != nil || raw == nil {
+		return nil, false, err
+	}
+
+	t := new(StoreToken)
+	err = json.Unmarshal(raw, t)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return t, true, nil
+}
+
+// DeleteToken Delete token and remove it from list of user in one MULTI
+func (r *RedisStore) DeleteToken(userId string, token string) (err error) {
+	conn := r.pool.Get()
+	if conn.Err() != nil {
+		err = conn.Err()
+		return
+	}
+
+	defer func(conn redis.Conn) {
+		err := conn.Close()
+		if err != nil {
+		}
+	}(conn)
+
+	err = conn.Send("MULTI")
+	if err != nil {
+		return err
+	}
+
+	err = conn.Send("DEL", r.tokenKey(token))
+	if err != nil {
+		return err
+	}
+
+	err = conn.Send("HDEL", r.userTokenKey(userId), token)
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.Do("EXEC")
+	return err
+}
+
+// ListUserToken List all live token of user, expired one in hash is deleted
+func (r *RedisStore) ListUserToken(userId string) (result []*StoreToken, err error) {
+	conn := r.pool.Get()
+	if conn.Err() != nil {
+		err = conn.Err()
+		return
+	}
+
+	defer func(conn redis.Conn) {
+		err := conn.Close()
+		if err != nil {
+		}
+	}(conn)
+
+	userKey := r.userTokenKey(userId)
+	m, err := redis.StringMap(conn.Do("HGETALL", userKey))
+	if err != nil {
+		return nil, err
+	}
+
+	now := r.now().Unix()
+	expired := make([]interface{}, 0)
+	result = make([]*StoreToken, 0, len(m))
+	for token, raw := range m {
+		t := new(StoreToken)
+		if json.Unmarshal([]byte(raw), t) != nil || t.ExpiresAt <= now {
+			expired = append(expired, token)
+			continue
+		}
+
+		result = append(result, t)
+	}
+
+	if len(expired) > 0 {
+		_, err = conn.Do("HDEL", append([]interface{}{userKey}, expired...)...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// GetUser Get user info cache
+func (r *RedisStore) GetUser(userId string) ([]byte, bool, error) {
+	raw, err := r.get(r.userKey(userId))
+	if err != nil || raw == nil {
+		return nil, false, err
+	}
+
+	return raw, true, nil
+}
+
+// SetUser Set user info cache
+func (r *RedisStore) SetUser(userId string, detail []byte, expiresAt int64) (err error) {
+	ttl := expiresAt - r.now().Unix()
+	if ttl <= 0 {
+		return r.DeleteUser(userId)
+	}
+
+	conn := r.pool.Get()
+	if conn.Err() != nil {
+		err = conn.Err()
+		return
+	}
+
+	defer func(conn redis.Conn) {
+		err := conn.Close()
+		if err != nil {
+		}
+	}(conn)
+
+	_, err = conn.Do("SETEX", r.userKey(userId), ttl, detail)
+	return err
+}
+
+// DeleteUser Delete user info cache
+func (r *RedisStore) DeleteUser(userId string) (err error) {
+	conn := r.pool.Get()
+	if conn.Err() != nil {
+		err = conn.Err()
+		return
+	}
+
+	defer func(conn redis.Conn) {
+		err := conn.Close()
+		if err != nil {
+		}
+	}(conn)
+
+	_, err = conn.Do("DEL", r.userKey(userId))
+	return err
+}
+
+// get value of key, not exist return nil
+func (r *RedisStore) get(key string) (raw []byte, err error) {
+	conn := r.pool.Get()
+	if conn.Err() != nil {
+		err = conn.Err()
+		return
+	}
+
+	defer func(conn redis.Conn) {
+		err := conn.Close()
+		if err != nil {
+		}
+	}(conn)
+
+	raw, err = redis.Bytes(conn.Do("GET", key))
+	if err == redis.ErrNil {
+		return nil, nil
+	}
+
+	return raw, err
+}
+
+func (r *RedisStore) tokenKey(token string) string {
+	return fmt.Sprintf("%s_%s", r.prefix, token)
+}
+
+func (r *RedisStore) userTokenKey(userId string) string {
+	return fmt.Sprintf("%s-user_%s", r.prefix, userId)
+}
+
+func (r *RedisStore) userKey(userId string) string {
+	return fmt.Sprintf("%s-info_%s", r.prefix, userId)
+}
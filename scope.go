@@ -0,0 +1,69 @@
+package gosession
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrScopeDenied token has not the scope required
+var ErrScopeDenied = errors.New("scope denied")
+
+// HasScopes granted scopes contain all required scopes, empty granted means full power.
+// Granted "*" match all, "orders:*" match "orders:read" and "orders:item:write".
+func HasScopes(granted []string, required ...string) bool {
+	if len(granted) == 0 {
+		return true
+	}
+
+	for _, r := range required {
+		if !hasScope(granted, r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func hasScope(granted []string, required string) bool {
+	for _, g := range granted {
+		if g == required || g == "*" {
+			return true
+		}
+
+		if strings.HasSuffix(g, ":*") && strings.HasPrefix(required, strings.TrimSuffix(g, "*")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SetTokenWithScopes Set token which can only do what scopes say, expire after some second,
+// scopes can not be empty, or it will be full power, use SetToken for that
+func (s *RedisSession) SetTokenWithScopes(userId string, tokenValidTimes int64, scopes []string) (token string, err error) {
+	if len(scopes) == 0 {
+		return "", errors.New("scopes empty")
+	}
+
+	for _, scope := range scopes {
+		if scope == "" {
+			return "", errors.New("scope empty")
+		}
+	}
+
+	return s.setToken(userId, tokenValidTimes, &tokenRecord{Scopes: scopes})
+}
+
+// RequireScopes Check the token like CheckToken, and it must has all scopes, or return ErrScopeDenied
+func (s *RedisSession) RequireScopes(token string, scopes ...string) (user *User, exist bool, err error) {
+	user, exist, err = s.CheckToken(token)
+	if err != nil || !exist {
+		return user, exist, err
+	}
+
+	if !HasScopes(user.Scopes, scopes...) {
+		return nil, true, ErrScopeDenied
+	}
+
+	return user, true, nil
+}
@@ -0,0 +1,44 @@
+package gosession
+
+import (
+	"testing"
+)
+
+func TestHasScopes(t *testing.T) {
+	cases := []struct {
+		granted  []string
+		required []string
+		want     bool
+	}{
+		{nil, []string{"orders:write"}, true},
+		{[]string{"*"}, []string{"orders:write"}, true},
+		{[]string{"orders:read"}, []string{"orders:read"}, true},
+		{[]string{"orders:read"}, []string{"orders:write"}, false},
+		{[]string{"orders:read"}, []string{"orders:read", "users:read"}, false},
+		{[]string{"orders:*"}, []string{"orders:read", "orders:item:write"}, true},
+		{[]string{"orders:*"}, []string{"ordersx:read"}, false},
+		{[]string{"orders:read"}, nil, true},
+	}
+
+	for _, c := range cases {
+		if got := HasScopes(c.granted, c.required...); got != c.want {
+			t.Fatalf("HasScopes(%v, %v) = %v, want %v", c.granted, c.required, got, c.want)
+		}
+	}
+
+	// jwt claims use the same rule
+	if err := (JwtData{Scopes: []string{"orders:read"}}).RequireScopes("orders:write"); err != ErrScopeDenied {
+		t.Fatal("jwt scope should deny")
+	}
+}
+
+func TestSetTokenWithScopesEmpty(t *testing.T) {
+	s := newRedisSession(nil, tokenKeyDefault, userKeyDefault, expireTimeDefault)
+
+	// empty scopes would be full power, not what caller want
+	for _, scopes := range [][]string{nil, {}, {"orders:read", ""}} {
+		if _, err := s.SetTokenWithScopes("1", 100, scopes); err == nil {
+			t.Fatalf("SetTokenWithScopes(%v) should fail", scopes)
+		}
+	}
+}
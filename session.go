@@ -13,18 +13,35 @@ type TokenManage interface {
 	RefreshUser(userId []string, userInfoValidTimes int64) error                                       // Refresh cache of user info batch
 	DeleteUser(userId string) error                                                                    // Delete user info in cache
 	AddUser(userId string, userInfoValidTimes int64) (user *User, exist bool, err error)               // Add the user info to cache，expire after some second
-	ConfigTokenKeyPrefix(tokenKey string) TokenManage                                                  // Config chain, just cache key prefix
-	ConfigUserKeyPrefix(userKey string) TokenManage                                                    // Config chain, just cache key prefix
+	ConfigTokenKeyPrefix(tokenKey string) TokenManage                                                  // Config chain, just cache key prefix, backend without key such sql table and file ignore it
+	ConfigUserKeyPrefix(userKey string) TokenManage                                                    // Config chain, just cache key prefix, backend without key such sql table and file ignore it
 	ConfigDefaultExpireTime(second int64) TokenManage                                                  // Config chain, token expire after second
 	ConfigGetUserInfoFunc(fn GetUserInfoFunc) TokenManage                                              // Config chain, when cache not found user info, will load from this func
+	AddEventListener(listener EventListener, async bool) TokenManage                                   // Config chain, listener receive session event such login, logout, async will run in its own goroutine
 	SetSingleMode() TokenManage                                                                        // Can set single mode, before one new token gen, will destroy other token
 }
 
+// UserInfoCacheConfig optional config of user info cache, not every TokenManage support it, assert to use it such
+//
+//	if c, ok := tokenManage.(UserInfoCacheConfig); ok {
+//		c.ConfigUserInfoSoftExpireTime(60)
+//	}
+type UserInfoCacheConfig interface {
+	ConfigUserInfoSoftExpireTime(second int64) TokenManage     // Config chain, user info cache older than second still return, but reload from func in background
+	ConfigUserInfoNegativeExpireTime(second int64) TokenManage // Config chain, user not found or load error will be cached second, not load from func again
+}
+
 // User core user info, it's Id will be the primary key store in cache database such redis
 type User struct {
-	Id                  string      `json:"id"`     // unique mark
-	TokenRemainLiveTime int64       `json:"-"`      // token remain live time in cache
-	TokenExpireTime     int64       `json:"-"`      // when token expire
-	Token               string      `json:"-"`      // this token
-	Detail              interface{} `json:"detail"` // can diy your real user info by config ConfigGetUserInfoFunc()
+	Id                  string            `json:"id"`     // unique mark
+	TokenRemainLiveTime int64             `json:"-"`      // token remain live time in cache
+	TokenExpireTime     int64             `json:"-"`      // when token expire
+	Token               string            `json:"-"`      // this token
+	Scopes              []string          `json:"-"`      // what this token can do, empty means full power
+	AuthLevel           AuthLevel         `json:"-"`      // authentication assurance level of this token
+	AuthTime            int64             `json:"-"`      // unix second when user last authenticated by this token
+	ImpersonatorId      string            `json:"-"`      // who log in as this user by this token, empty means user self
+	Meta                map[string]string `json:"-"`      // custom metadata of this token, only StoreSession support, see SetTokenWithMeta
+	Detail              interface{}       `json:"detail"` // can diy your real user info by config ConfigGetUserInfoFunc()
+	record              *tokenRecord      // record of this token, such binding
 }
@@ -0,0 +1,427 @@
+// Package sessiontest conformance test of gosession.TokenManage, any backend such third party one
+// can run it in its own test to prove it work the same as the shipped one.
+package sessiontest
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hunterhug/gosession"
+)
+
+// Factory new a TokenManage for one sub test, the session should be fresh,
+// or at least not share user id with others, which is random by suite
+type Factory func(t *testing.T) gosession.TokenManage
+
+var userSeq int64
+
+// uniq user id, so backend shared by sub test such redis not conflict
+func newUserId() string {
+	return fmt.Sprintf("u%d%d", time.Now().UnixNano(), atomic.AddInt64(&userSeq, 1))
+}
+
+// ClockFactory like Factory, but the session should get now from clock, so expiry advance it not sleep
+type ClockFactory func(t *testing.T, clock gosession.Clock) gosession.TokenManage
+
+// RunConformance run every contract of TokenManage as sub test, expiry one will sleep some second
+func RunConformance(t *testing.T, factory Factory) {
+	run(t, func(t *testing.T) (gosession.TokenManage, func(d time.Duration), func() time.Time) {
+		return factory(t), time.Sleep, time.Now
+	})
+}
+
+// RunConformanceWithClock same as RunConformance, but every sub test has its own fake clock,
+// backend which expire by real time such redis key ttl can not use it
+func RunConformanceWithClock(t *testing.T, factory ClockFactory) {
+	run(t, func(t *testing.T) (gosession.TokenManage, func(d time.Duration), func() time.Time) {
+		clock := gosession.NewFakeClock(time.Now())
+		return factory(t, clock), clock.Advance, clock.Now
+	})
+}
+
+// new session, how to wait time pass and where get now
+type setup func(t *testing.T) (gosession.TokenManage, func(d time.Duration), func() time.Time)
+
+func run(t *testing.T, setup setup) {
+	for _, c := range []struct {
+		name string
+		test func(t *testing.T, s gosession.TokenManage, wait func(d time.Duration), now func() time.Time)
+	}{
+		{"SetAndCheck", testSetAndCheck},
+		{"DeleteToken", testDeleteToken},
+		{"Refresh", testRefresh},
+		{"Expire", testExpire},
+		{"ListAfterOnlyExpire", testListAfterOnlyExpire},
+		{"RefreshExpired", testRefreshExpired},
+		{"SingleMode", testSingleMode},
+		{"DeleteUserToken", testDeleteUserToken},
+		{"UserCache", testUserCache},
+		{"UserNotFound", testUserNotFound},
+		{"ConcurrentSetAndDelete", testConcurrent},
+	} {
+		test := c.test
+		t.Run(c.name, func(t *testing.T) {
+			s, wait, now := setup(t)
+			test(t, s, wait, now)
+		})
+	}
+}
+
+func mustSetToken(t *testing.T, s gosession.TokenManage, userId string, ttl int64) string {
+	t.Helper()
+	token, err := s.SetToken(userId, ttl)
+	if err != nil {
+		t.Fatalf("SetToken(%s): %v", userId, err)
+	}
+
+	if token == "" {
+		t.Fatalf("SetToken(%s) return empty token", userId)
+	}
+
+	return token
+}
+
+func mustExist(t *testing.T, s gosession.TokenManage, token string, want bool) *gosession.User {
+	t.Helper()
+	user, exist, err := s.CheckToken(token)
+	if err != nil {
+		t.Fatalf("CheckToken(%s): %v", token, err)
+	}
+
+	if exist != want {
+		t.Fatalf("CheckToken(%s) exist = %v, want %v", token, exist, want)
+	}
+
+	return user
+}
+
+func mustList(t *testing.T, s gosession.TokenManage, userId string, want ...string) {
+	t.Helper()
+	tokens, err := s.ListUserToken(userId)
+	if err != nil {
+		t.Fatalf("ListUserToken(%s): %v", userId, err)
+	}
+
+	sort.Strings(tokens)
+	sort.Strings(want)
+	if fmt.Sprint(tokens) != fmt.Sprint(want) {
+		t.Fatalf("ListUserToken(%s) = %v, want %v", userId, tokens, want)
+	}
+}
+
+func testSetAndCheck(t *testing.T, s gosession.TokenManage, wait func(d time.Duration), now func() time.Time) {
+	userId := newUserId()
+	token1 := mustSetToken(t, s, userId, 100)
+	token2 := mustSetToken(t, s, userId, 100)
+	if token1 == token2 {
+		t.Fatal("token should be different")
+	}
+
+	user := mustExist(t, s, token1, true)
+	if user.Id != userId || user.Token != token1 {
+		t.Fatalf("user = %+v, want id %s token %s", user, userId, token1)
+	}
+
+	if user.TokenRemainLiveTime <= 0 || user.TokenRemainLiveTime > 100 {
+		t.Fatalf("TokenRemainLiveTime = %d, want in (0, 100]", user.TokenRemainLiveTime)
+	}
+
+	if left := user.TokenExpireTime - now().Unix(); left < 0 || left > 100 {
+		t.Fatalf("TokenExpireTime = %d, want in [now, now+100], now %d", user.TokenExpireTime, now().Unix())
+	}
+
+	mustList(t, s, userId, token1, token2)
+	mustExist(t, s, newUserId()+"_notexist", false)
+
+	if _, err := s.SetToken("", 100); err == nil {
+		t.Fatal("SetToken with empty user id should fail")
+	}
+}
+
+func testDeleteToken(t *testing.T, s gosession.TokenManage, wait func(d time.Duration), now func() time.Time) {
+	userId := newUserId()
+	token1 := mustSetToken(t, s, userId, 100)
+	token2 := mustSetToken(t, s, userId, 100)
+
+	if err := s.DeleteToken(token1); err != nil {
+		t.Fatalf("DeleteToken: %v", err)
+	}
+
+	mustExist(t, s, token1, false)
+	mustExist(t, s, token2, true)
+	mustList(t, s, userId, token2)
+
+	// delete again not error
+	if err := s.DeleteToken(token1); err != nil {
+		t.Fatalf("DeleteToken again: %v", err)
+	}
+}
+
+func testRefresh(t *testing.T, s gosession.TokenManage, wait func(d time.Duration), now func() time.Time) {
+	userId := newUserId()
+	token := mustSetToken(t, s, userId, 10)
+
+	if err := s.RefreshToken(token, 1000); err != nil {
+		t.Fatalf("RefreshToken: %v", err)
+	}
+
+	user := mustExist(t, s, token, true)
+	if user.TokenRemainLiveTime <= 10 {
+		t.Fatalf("TokenRemainLiveTime = %d after refresh, want > 10", user.TokenRemainLiveTime)
+	}
+
+	mustList(t, s, userId, token)
+}
+
+func testExpire(t *testing.T, s gosession.TokenManage, wait func(d time.Duration), now func() time.Time) {
+	userId := newUserId()
+	short := mustSetToken(t, s, userId, 1)
+	long := mustSetToken(t, s, userId, 100)
+	refreshed := mustSetToken(t, s, userId, 1)
+	if err := s.RefreshToken(refreshed, 100); err != nil {
+		t.Fatalf("RefreshToken: %v", err)
+	}
+
+	wait(2100 * time.Millisecond)
+
+	mustExist(t, s, short, false)
+	mustExist(t, s, long, true)
+	mustExist(t, s, refreshed, true)
+	mustList(t, s, userId, long, refreshed)
+}
+
+func testListAfterOnlyExpire(t *testing.T, s gosession.TokenManage, wait func(d time.Duration), now func() time.Time) {
+	userId := newUserId()
+	token := mustSetToken(t, s, userId, 1)
+	mustList(t, s, userId, token)
+
+	wait(2100 * time.Millisecond)
+
+	// list first, not let check clean it
+	mustList(t, s, userId)
+	mustExist(t, s, token, false)
+	mustList(t, s, userId)
+}
+
+func testRefreshExpired(t *testing.T, s gosession.TokenManage, wait func(d time.Duration), now func() time.Time) {
+	userId := newUserId()
+	token := mustSetToken(t, s, userId, 1)
+
+	wait(2100 * time.Millisecond)
+
+	// backend can refuse it or set it again, but list and check must agree
+	err := s.RefreshToken(token, 100)
+	if err != nil {
+		mustExist(t, s, token, false)
+		mustList(t, s, userId)
+		return
+	}
+
+	user := mustExist(t, s, token, true)
+	if user.TokenRemainLiveTime <= 0 || user.TokenRemainLiveTime > 100 {
+		t.Fatalf("TokenRemainLiveTime = %d after refresh expired, want in (0, 100]", user.TokenRemainLiveTime)
+	}
+	mustList(t, s, userId, token)
+}
+
+func testSingleMode(t *testing.T, s gosession.TokenManage, wait func(d time.Duration), now func() time.Time) {
+	s.SetSingleMode()
+
+	userId := newUserId()
+	other := newUserId()
+	token1 := mustSetToken(t, s, userId, 100)
+	otherToken := mustSetToken(t, s, other, 100)
+	token2 := mustSetToken(t, s, userId, 100)
+
+	mustExist(t, s, token1, false)
+	mustExist(t, s, token2, true)
+	mustExist(t, s, otherToken, true)
+	mustList(t, s, userId, token2)
+}
+
+func testDeleteUserToken(t *testing.T, s gosession.TokenManage, wait func(d time.Duration), now func() time.Time) {
+	userId := newUserId()
+	other := newUserId()
+	token1 := mustSetToken(t, s, userId, 100)
+	token2 := mustSetToken(t, s, userId, 100)
+	otherToken := mustSetToken(t, s, other, 100)
+
+	if err := s.DeleteUserToken(userId); err != nil {
+		t.Fatalf("DeleteUserToken: %v", err)
+	}
+
+	mustExist(t, s, token1, false)
+	mustExist(t, s, token2, false)
+	mustExist(t, s, otherToken, true)
+	mustList(t, s, userId)
+	mustList(t, s, other, otherToken)
+}
+
+func testUserCache(t *testing.T, s gosession.TokenManage, wait func(d time.Duration), now func() time.Time) {
+	var loads int64
+	s.ConfigGetUserInfoFunc(func(id string) (*gosession.User, error) {
+		n := atomic.AddInt64(&loads, 1)
+		return &gosession.User{Id: id, Detail: fmt.Sprintf("load %d", n)}, nil
+	})
+
+	userId := newUserId()
+	token := mustSetToken(t, s, userId, 100)
+
+	check := func(wantDetail string, wantLoads int64) {
+		t.Helper()
+		user, exist, err := s.CheckTokenOrUpdateUser(token, 100)
+		if err != nil || !exist {
+			t.Fatalf("CheckTokenOrUpdateUser: exist %v, err %v", exist, err)
+		}
+
+		if user.Id != userId || user.Token != token || fmt.Sprint(user.Detail) != wantDetail {
+			t.Fatalf("user = %+v, want detail %s", user, wantDetail)
+		}
+
+		if n := atomic.LoadInt64(&loads); n != wantLoads {
+			t.Fatalf("getUserFunc called %d times, want %d", n, wantLoads)
+		}
+	}
+
+	check("load 1", 1)
+	check("load 1", 1)
+
+	// check token not touch user cache
+	user := mustExist(t, s, token, true)
+	if user.Id != userId {
+		t.Fatalf("CheckToken user id = %s, want %s", user.Id, userId)
+	}
+
+	if err := s.DeleteUser(userId); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	check("load 2", 2)
+
+	if err := s.RefreshUser([]string{userId}, 100); err != nil {
+		t.Fatalf("RefreshUser: %v", err)
+	}
+	check("load 3", 3)
+
+	user, exist, err := s.AddUser(userId, 100)
+	if err != nil || !exist || user.Id != userId {
+		t.Fatalf("AddUser: %+v %v %v", user, exist, err)
+	}
+	check("load 4", 4)
+
+	// cache expire, load again
+	if _, _, err = s.AddUser(userId, 1); err != nil {
+		t.Fatalf("AddUser: %v", err)
+	}
+	wait(2100 * time.Millisecond)
+	check("load 6", 6)
+}
+
+func testUserNotFound(t *testing.T, s gosession.TokenManage, wait func(d time.Duration), now func() time.Time) {
+	s.ConfigGetUserInfoFunc(func(id string) (*gosession.User, error) {
+		return nil, gosession.ErrUserNotFound
+	})
+
+	token := mustSetToken(t, s, newUserId(), 100)
+	user, exist, err := s.CheckTokenOrUpdateUser(token, 100)
+	if err != nil && !errors.Is(err, gosession.ErrUserNotFound) {
+		t.Fatalf("CheckTokenOrUpdateUser: %v", err)
+	}
+
+	if exist || user != nil {
+		t.Fatalf("CheckTokenOrUpdateUser of not found user = %+v %v, want nil false", user, exist)
+	}
+}
+
+func testConcurrent(t *testing.T, s gosession.TokenManage, wait func(d time.Duration), now func() time.Time) {
+	userId := newUserId()
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		tokens []string
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := s.SetToken(userId, 100)
+			if err != nil {
+				t.Errorf("SetToken: %v", err)
+				return
+			}
+
+			mu.Lock()
+			tokens = append(tokens, token)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if t.Failed() {
+		return
+	}
+
+	// no write lost
+	mustList(t, s, userId, tokens...)
+
+	var raced []string
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			token, err := s.SetToken(userId, 100)
+			if err != nil {
+				t.Errorf("SetToken: %v", err)
+				return
+			}
+
+			mu.Lock()
+			raced = append(raced, token)
+			mu.Unlock()
+		}()
+		go func() {
+			defer wg.Done()
+			if err := s.DeleteUserToken(userId); err != nil {
+				t.Errorf("DeleteUserToken: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if t.Failed() {
+		return
+	}
+
+	// every token left must be live and listed, then delete all win
+	left, err := s.ListUserToken(userId)
+	if err != nil {
+		t.Fatalf("ListUserToken: %v", err)
+	}
+
+	listed := make(map[string]bool, len(left))
+	for _, token := range left {
+		mustExist(t, s, token, true)
+		listed[token] = true
+	}
+
+	// live one not in list can not be revoked by DeleteUserToken
+	for _, token := range raced {
+		if !listed[token] {
+			mustExist(t, s, token, false)
+		}
+	}
+
+	if err := s.DeleteUserToken(userId); err != nil {
+		t.Fatalf("DeleteUserToken: %v", err)
+	}
+
+	mustList(t, s, userId)
+	for _, token := range append(append(tokens, left...), raced...) {
+		mustExist(t, s, token, false)
+	}
+}
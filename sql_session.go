@@ -0,0 +1,704 @@
+package gosession
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SQLDialect which database the *sql.DB connect to
+type SQLDialect int
+
+const (
+	DialectMySQL    SQLDialect = iota // MySQL 5.7+ or MariaDB
+	DialectPostgres                   // PostgreSQL 9.5+
+	DialectSQLite                     // SQLite 3.24+
+)
+
+const (
+	sqlTokenTable     = "gosession_token"      // token and whose it is, lookup by token
+	sqlUserTokenTable = "gosession_user_token" // all token of user, lookup by user id
+	sqlUserTable      = "gosession_user"       // user info cache
+	sqlMigrationTable = "gosession_migration"  // which schema version applied
+)
+
+// sqlMigration one version of schema, apply by order and only once,
+// every statement must be idempotent, mysql commit DDL at once so half applied one will run again
+type sqlMigration struct {
+	version    int64
+	statements []string
+	indexes    []sqlIndex
+}
+
+// sqlIndex index create after the table, mysql not support CREATE INDEX IF NOT EXISTS, check it first
+type sqlIndex struct {
+	name    string
+	table   string
+	columns string
+}
+
+// schema of all dialect, never change the applied one, add new version instead
+var sqlMigrations = []sqlMigration{
+	{
+		version: 1,
+		statements: []string{
+			"CREATE TABLE IF NOT EXISTS " + sqlTokenTable + " (token VARCHAR(191) NOT NULL, user_id VARCHAR(191) NOT NULL, created_at BIGINT NOT NULL, expires_at BIGINT NOT NULL, PRIMARY KEY (token))",
+			"CREATE TABLE IF NOT EXISTS " + sqlUserTokenTable + " (user_id VARCHAR(191) NOT NULL, token VARCHAR(191) NOT NULL, expires_at BIGINT NOT NULL, PRIMARY KEY (user_id, token))",
+			"CREATE TABLE IF NOT EXISTS " + sqlUserTable + " (user_id VARCHAR(191) NOT NULL, detail TEXT NOT NULL, expires_at BIGINT NOT NULL, PRIMARY KEY (user_id))",
+		},
+		indexes: []sqlIndex{
+			{"idx_" + sqlTokenTable + "_user_id", sqlTokenTable, "user_id"},
+			{"idx_" + sqlTokenTable + "_expires_at", sqlTokenTable, "expires_at"},
+			{"idx_" + sqlUserTokenTable + "_expires_at", sqlUserTokenTable, "expires_at"},
+			{"idx_" + sqlUserTable + "_expires_at", sqlUserTable, "expires_at"},
+		},
+	},
+}
+
+// SQLSession session by database/sql, token and user info cache store in table, expire by expires_at column
+type SQLSession struct {
+	db           *sql.DB                        // database handle, driver import by caller
+	dialect      SQLDialect                     // which database
+	getUserFunc  func(id string) (*User, error) // when not hit cache will get user from this func
+	expireTime   int64                          // token expire how much second，default  7 days
+	isSingleMode bool                           // is single token, new token will destroy other token
+	events       *eventHub                      // session event listener
+	clock        Clock                          // where get now, nil means SystemClock
+	purgeMu      sync.Mutex                     // guard purgeCancel
+	purgeCancel  chan struct{}                  // stop the periodic purge
+}
+
+// NewSQLSession new a session by database/sql, the schema will be migrated at once,
+// driver such github.com/go-sql-driver/mysql, github.com/lib/pq or github.com/mattn/go-sqlite3 should be imported by caller
+func NewSQLSession(db *sql.DB, dialect SQLDialect) (TokenManage, error) {
+	if db == nil {
+		return nil, errors.New("sql db is nil")
+	}
+
+	if dialect != DialectMySQL && dialect != DialectPostgres && dialect != DialectSQLite {
+		return nil, fmt.Errorf("sql dialect wrong: %d", dialect)
+	}
+
+	s := &SQLSession{
+		db:         db,
+		dialect:    dialect,
+		expireTime: expireTimeDefault,
+		events:     newEventHub(),
+	}
+
+	err := s.Migrate()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Migrate create the table and index, only the version not applied will run,
+// it is safe to run again after half applied, or by many instance at the same time
+func (s *SQLSession) Migrate() (err error) {
+	_, err = s.db.Exec("CREATE TABLE IF NOT EXISTS " + sqlMigrationTable + " (version BIGINT NOT NULL, applied_at BIGINT NOT NULL, PRIMARY KEY (version))")
+	if err != nil {
+		return err
+	}
+
+	rows, err := s.db.Query("SELECT version FROM " + sqlMigrationTable)
+	if err != nil {
+		return err
+	}
+
+	applied := make(map[int64]bool)
+	for rows.Next() {
+		var version int64
+		err = rows.Scan(&version)
+		if err != nil {
+			_ = rows.Close()
+			return err
+		}
+		applied[version] = true
+	}
+
+	err = rows.Close()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range sqlMigrations {
+		if applied[m.version] {
+			continue
+		}
+
+		err = s.inTx(func(tx *sql.Tx) error {
+			for _, statement := range m.statements {
+				_, err := tx.Exec(statement)
+				if err != nil {
+					return fmt.Errorf("migrate version %d: %w", m.version, err)
+				}
+			}
+
+			for _, index := range m.indexes {
+				err := s.createIndex(tx, index)
+				if err != nil {
+					return fmt.Errorf("migrate version %d: %w", m.version, err)
+				}
+			}
+
+			// other instance may apply it at the same time
+			_, err := tx.Exec(s.upsert(sqlMigrationTable, []string{"version", "applied_at"}, []string{"version"}, []string{"applied_at"}), m.version, s.now().Unix())
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// create index if not exist
+func (s *SQLSession) createIndex(tx *sql.Tx, index sqlIndex) (err error) {
+	if s.dialect != DialectMySQL {
+		_, err = tx.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s)", index.name, index.table, index.columns))
+		return err
+	}
+
+	exist, err := s.mysqlIndexExist(index)
+	if err != nil || exist {
+		return err
+	}
+
+	_, err = tx.Exec(fmt.Sprintf("CREATE INDEX %s ON %s (%s)", index.name, index.table, index.columns))
+	if err != nil {
+		// created by other instance at the same time
+		exist, errExist := s.mysqlIndexExist(index)
+		if errExist == nil && exist {
+			return nil
+		}
+	}
+
+	return err
+}
+
+// mysql index exist in current database
+func (s *SQLSession) mysqlIndexExist(index sqlIndex) (exist bool, err error) {
+	var count int64
+	err = s.db.QueryRow("SELECT COUNT(*) FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = ? AND index_name = ?",
+		index.table, index.name).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// ConfigTokenKeyPrefix config by chain, table name is fixed, nothing to do
+func (s *SQLSession) ConfigTokenKeyPrefix(tokenKey string) TokenManage {
+	return s
+}
+
+// ConfigUserKeyPrefix config by chain, table name is fixed, nothing to do
+func (s *SQLSession) ConfigUserKeyPrefix(userKey string) TokenManage {
+	return s
+}
+
+// ConfigDefaultExpireTime config by chain
+func (s *SQLSession) ConfigDefaultExpireTime(second int64) TokenManage {
+	if second > 0 {
+		s.expireTime = second
+	}
+	return s
+}
+
+// ConfigGetUserInfoFunc config by chain
+func (s *SQLSession) ConfigGetUserInfoFunc(fn GetUserInfoFunc) TokenManage {
+	s.getUserFunc = fn
+	return s
+}
+
+// AddEventListener config by chain
+func (s *SQLSession) AddEventListener(listener EventListener, async bool) TokenManage {
+	s.events.add(listener, async)
+	return s
+}
+
+// SetSingleMode config by chain
+func (s *SQLSession) SetSingleMode() TokenManage {
+	s.isSingleMode = true
+	return s
+}
+
+// SetToken Set token, expire after some second
+func (s *SQLSession) SetToken(userId string, tokenValidTimes int64) (token string, err error) {
+	if userId == "" {
+		err = errors.New("user id nil")
+		return
+	}
+
+	if tokenValidTimes <= 0 {
+		tokenValidTimes = s.expireTime
+	}
+
+	// if single, destroy other token first
+	if s.isSingleMode {
+		err = s.deleteUserToken(userId, EventEvict, "single mode")
+		if err != nil {
+			return "", err
+		}
+	}
+
+	token = fmt.Sprintf("%s_%s", userId, GetGUID())
+	now := s.now().Unix()
+	err = s.inTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(s.rebind("INSERT INTO "+sqlTokenTable+" (token, user_id, created_at, expires_at) VALUES (?, ?, ?, ?)"),
+			token, userId, now, now+tokenValidTimes)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(s.rebind("INSERT INTO "+sqlUserTokenTable+" (user_id, token, expires_at) VALUES (?, ?, ?)"),
+			userId, token, now+tokenValidTimes)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	s.emit(EventLogin, userId, token, tokenValidTimes, "")
+	return token, nil
+}
+
+// RefreshToken Refresh token，token expire will be again after some second, not exist will set a new one
+func (s *SQLSession) RefreshToken(token string, tokenValidTimes int64) (err error) {
+	userId, err := tokenUserId(token)
+	if err != nil {
+		return err
+	}
+
+	if tokenValidTimes <= 0 {
+		tokenValidTimes = s.expireTime
+	}
+
+	now := s.now().Unix()
+	err = s.inTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(s.upsert(sqlTokenTable, []string{"token", "user_id", "created_at", "expires_at"}, []string{"token"}, []string{"expires_at"}),
+			token, userId, now, now+tokenValidTimes)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(s.upsert(sqlUserTokenTable, []string{"user_id", "token", "expires_at"}, []string{"user_id", "token"}, []string{"expires_at"}),
+			userId, token, now+tokenValidTimes)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	s.emit(EventRefresh, userId, token, tokenValidTimes, "")
+	return nil
+}
+
+// DeleteToken Delete token when you do action such logout
+func (s *SQLSession) DeleteToken(token string) (err error) {
+	userId, err := tokenUserId(token)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := s.deleteToken(userId, token)
+	if err != nil {
+		return err
+	}
+
+	if deleted {
+		s.emit(EventLogout, userId, token, 0, "delete token")
+	}
+
+	return nil
+}
+
+func (s *SQLSession) deleteToken(userId string, token string) (deleted bool, err error) {
+	err = s.inTx(func(tx *sql.Tx) error {
+		result, err := tx.Exec(s.rebind("DELETE FROM "+sqlTokenTable+" WHERE token = ?"), token)
+		if err != nil {
+			return err
+		}
+
+		count, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		deleted = count > 0
+
+		_, err = tx.Exec(s.rebind("DELETE FROM "+sqlUserTokenTable+" WHERE user_id = ? AND token = ?"), userId, token)
+		return err
+	})
+	return deleted, err
+}
+
+// CheckToken Check the token, but not refresh user info cache
+func (s *SQLSession) CheckToken(token string) (user *User, exist bool, err error) {
+	return s.CheckTokenOrUpdateUser(token, -1)
+}
+
+// CheckTokenOrUpdateUser Check the token, when user info cache exist return directly,
+// others load by getUserFunc and save in cache, if s.getUserFunc == nil do nothing
+func (s *SQLSession) CheckTokenOrUpdateUser(token string, userInfoValidTimes int64) (user *User, exist bool, err error) {
+	userId, err := tokenUserId(token)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var ownerId string
+	var expiresAt int64
+	err = s.db.QueryRow(s.rebind("SELECT user_id, expires_at FROM "+sqlTokenTable+" WHERE token = ?"), token).Scan(&ownerId, &expiresAt)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	if ownerId != userId {
+		return nil, false, errors.New("token user invalid")
+	}
+
+	now := s.now().Unix()
+	if expiresAt <= now {
+		deleted, err := s.deleteToken(userId, token)
+		if err != nil {
+			return nil, false, err
+		}
+
+		// first one find it expire
+		if deleted {
+			s.emit(EventExpire, userId, token, 0, "check token")
+		}
+		return nil, false, nil
+	}
+
+	if s.getUserFunc == nil || userInfoValidTimes < 0 {
+		user = new(User)
+		user.Id = userId
+	} else {
+		user, exist, err = s.loadUser(userId, userInfoValidTimes)
+		if err != nil || !exist {
+			return nil, false, err
+		}
+	}
+
+	user.Token = token
+	user.TokenRemainLiveTime = expiresAt - now
+	user.TokenExpireTime = expiresAt
+	return user, true, nil
+}
+
+// load user info from cache table, when not hit load by getUserFunc and put in cache
+func (s *SQLSession) loadUser(userId string, userInfoValidTimes int64) (user *User, exist bool, err error) {
+	var detail string
+	err = s.db.QueryRow(s.rebind("SELECT detail FROM "+sqlUserTable+" WHERE user_id = ? AND expires_at > ?"), userId, s.now().Unix()).Scan(&detail)
+	if err == sql.ErrNoRows {
+		return s.AddUser(userId, userInfoValidTimes)
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	user = new(User)
+	err = json.Unmarshal([]byte(detail), user)
+	if err != nil {
+		return nil, false, err
+	}
+
+	user.Id = userId
+	return user, true, nil
+}
+
+// ListUserToken List all live token in one user
+func (s *SQLSession) ListUserToken(userId string) ([]string, error) {
+	if userId == "" {
+		return nil, errors.New("user id empty")
+	}
+
+	rows, err := s.db.Query(s.rebind("SELECT token FROM "+sqlUserTokenTable+" WHERE user_id = ? AND expires_at > ?"), userId, s.now().Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+		}
+	}(rows)
+
+	result := make([]string, 0)
+	for rows.Next() {
+		var token string
+		err = rows.Scan(&token)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, token)
+	}
+
+	return result, rows.Err()
+}
+
+// DeleteUserToken Delete all token of this user
+func (s *SQLSession) DeleteUserToken(userId string) (err error) {
+	err = s.deleteUserToken(userId, EventLogout, "delete user token")
+	if err != nil {
+		return err
+	}
+
+	s.emit(EventRevokeAll, userId, "", 0, "delete user token")
+	return nil
+}
+
+// delete all token of this user, every token will emit event eventType
+func (s *SQLSession) deleteUserToken(userId string, eventType EventType, reason string) (err error) {
+	if userId == "" {
+		err = errors.New("user id empty")
+		return
+	}
+
+	tokens, err := s.ListUserToken(userId)
+	if err != nil {
+		return err
+	}
+
+	err = s.inTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(s.rebind("DELETE FROM "+sqlTokenTable+" WHERE user_id = ?"), userId)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(s.rebind("DELETE FROM "+sqlUserTokenTable+" WHERE user_id = ?"), userId)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, token := range tokens {
+		s.emit(eventType, userId, token, 0, reason)
+	}
+
+	return nil
+}
+
+// RefreshUser Refresh cache of user info batch
+func (s *SQLSession) RefreshUser(ids []string, userInfoValidTimes int64) (err error) {
+	for _, id := range ids {
+		_, _, err = s.AddUser(id, userInfoValidTimes)
+		if err != nil {
+			return err
+		}
+
+		// cache fill by check not emit, only here and DeleteUser
+		s.emit(EventUserUpdated, id, "", 0, "refresh user")
+	}
+
+	return nil
+}
+
+// DeleteUser Delete user info in cache
+func (s *SQLSession) DeleteUser(userId string) (err error) {
+	if userId == "" {
+		err = errors.New("user id empty")
+		return
+	}
+
+	_, err = s.db.Exec(s.rebind("DELETE FROM "+sqlUserTable+" WHERE user_id = ?"), userId)
+	if err != nil {
+		return err
+	}
+
+	s.emit(EventUserUpdated, userId, "", 0, "delete user")
+	return nil
+}
+
+// AddUser Add the user info to cache，expire after some second
+func (s *SQLSession) AddUser(userId string, userInfoValidTimes int64) (user *User, exist bool, err error) {
+	if s.getUserFunc == nil {
+		return nil, false, errors.New("getUserFunc nil")
+	}
+
+	if userId == "" {
+		err = errors.New("user id empty")
+		return
+	}
+
+	user, err = s.getUserFunc(userId)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	if user == nil {
+		user = new(User)
+	}
+
+	user.Id = userId
+
+	raw, err := json.Marshal(user)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if userInfoValidTimes <= 0 {
+		userInfoValidTimes = s.expireTime
+	}
+
+	_, err = s.db.Exec(s.upsert(sqlUserTable, []string{"user_id", "detail", "expires_at"}, []string{"user_id"}, []string{"detail", "expires_at"}),
+		userId, string(raw), s.now().Unix()+userInfoValidTimes)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return user, true, nil
+}
+
+// Purge delete all expired row, return how many deleted
+func (s *SQLSession) Purge() (count int64, err error) {
+	now := s.now().Unix()
+	for _, table := range []string{sqlTokenTable, sqlUserTokenTable, sqlUserTable} {
+		result, err := s.db.Exec(s.rebind("DELETE FROM "+table+" WHERE expires_at <= ?"), now)
+		if err != nil {
+			return count, err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return count, err
+		}
+		count += affected
+	}
+
+	return count, nil
+}
+
+// StartPurge run Purge every interval in background, call it again will restart
+func (s *SQLSession) StartPurge(interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	s.purgeMu.Lock()
+	if s.purgeCancel != nil {
+		close(s.purgeCancel)
+	}
+	cancel := make(chan struct{})
+	s.purgeCancel = cancel
+	s.purgeMu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-cancel:
+				return
+			case <-ticker.C:
+				_, err := s.Purge()
+				if err != nil {
+				}
+			}
+		}
+	}()
+}
+
+// StopPurge stop background purge
+func (s *SQLSession) StopPurge() {
+	s.purgeMu.Lock()
+	if s.purgeCancel != nil {
+		close(s.purgeCancel)
+		s.purgeCancel = nil
+	}
+	s.purgeMu.Unlock()
+}
+
+// EventDropped how many event dropped because queue of async listener full
+func (s *SQLSession) EventDropped() int64 {
+	return s.events.droppedCount()
+}
+
+// emit session event to listener
+func (s *SQLSession) emit(eventType EventType, userId string, token string, ttl int64, reason string) {
+	s.events.emit(&Event{Type: eventType, UserId: userId, Token: token, TTL: ttl, Reason: reason})
+}
+
+// run fn in transaction, rollback when error
+func (s *SQLSession) inTx(fn func(tx *sql.Tx) error) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = fn(tx)
+	if err != nil {
+		errRollback := tx.Rollback()
+		if errRollback != nil {
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// postgres use $1, $2 as placeholder
+func (s *SQLSession) rebind(query string) string {
+	if s.dialect != DialectPostgres {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString(fmt.Sprintf("$%d", n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// insert or update the columns when key conflict
+func (s *SQLSession) upsert(table string, columns []string, keys []string, updates []string) string {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, strings.Join(columns, ", "), placeholders)
+
+	sets := make([]string, 0, len(updates))
+	if s.dialect == DialectMySQL {
+		for _, c := range updates {
+			sets = append(sets, fmt.Sprintf("%s = VALUES(%s)", c, c))
+		}
+		query += " ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", ")
+	} else {
+		for _, c := range updates {
+			sets = append(sets, fmt.Sprintf("%s = excluded.%s", c, c))
+		}
+		query += fmt.Sprintf(" ON CONFLICT (%s) DO UPDATE SET %s", strings.Join(keys, ", "), strings.Join(sets, ", "))
+	}
+
+	return s.rebind(query)
+}
+
+// token has prefix user id
+func tokenUserId(token string) (userId string, err error) {
+	if token == "" {
+		return "", errors.New("token empty")
+	}
+
+	temp := strings.Split(token, "_")
+	if len(temp) < 2 || temp[0] == "" {
+		return "", errors.New("token wrong")
+	}
+
+	return temp[0], nil
+}
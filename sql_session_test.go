@@ -0,0 +1,484 @@
+package gosession
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSQLDriver in process database/sql driver, only understand the simple sql SQLSession use
+type fakeSQLDriver struct {
+	mu  sync.Mutex
+	dbs map[string]*fakeSQLDB
+}
+
+type fakeSQLDB struct {
+	mu      sync.Mutex
+	tables  map[string]*fakeSQLTable
+	indexes map[string]bool
+}
+
+type fakeSQLTable struct {
+	keys []string
+	rows []map[string]driver.Value
+}
+
+var (
+	fakeSQL = &fakeSQLDriver{dbs: map[string]*fakeSQLDB{}}
+
+	fakeCreateTable = regexp.MustCompile(`^CREATE TABLE IF NOT EXISTS (\w+) \(.*PRIMARY KEY \(([\w, ]+)\)\)$`)
+	fakeCreateIndex = regexp.MustCompile(`^CREATE INDEX (IF NOT EXISTS )?(\w+) ON \w+ \([\w, ]+\)$`)
+	fakeIndexExist  = regexp.MustCompile(`^SELECT COUNT\(\*\) FROM information_schema\.statistics WHERE .*index_name = \?$`)
+	fakeInsert      = regexp.MustCompile(`^INSERT INTO (\w+) \(([\w, ]+)\) VALUES \([?, ]+\)( ON .*)?$`)
+	fakeSelect      = regexp.MustCompile(`^SELECT ([\w, ]+) FROM (\w+)(?: WHERE (.*))?$`)
+	fakeDelete      = regexp.MustCompile(`^DELETE FROM (\w+)(?: WHERE (.*))?$`)
+	fakeCondition   = regexp.MustCompile(`^(\w+) (=|>|<=) \?$`)
+)
+
+func init() {
+	sql.Register("gosession-fake", fakeSQL)
+}
+
+func (d *fakeSQLDriver) Open(name string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	db, ok := d.dbs[name]
+	if !ok {
+		db = &fakeSQLDB{tables: map[string]*fakeSQLTable{}, indexes: map[string]bool{}}
+		d.dbs[name] = db
+	}
+	return &fakeSQLConn{db: db}, nil
+}
+
+type fakeSQLConn struct {
+	db *fakeSQLDB
+}
+
+func (c *fakeSQLConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeSQLStmt{db: c.db, query: query}, nil
+}
+
+func (c *fakeSQLConn) Close() error              { return nil }
+func (c *fakeSQLConn) Begin() (driver.Tx, error) { return c, nil }
+func (c *fakeSQLConn) Commit() error             { return nil }
+func (c *fakeSQLConn) Rollback() error           { return nil }
+
+type fakeSQLStmt struct {
+	db    *fakeSQLDB
+	query string
+}
+
+func (s *fakeSQLStmt) Close() error  { return nil }
+func (s *fakeSQLStmt) NumInput() int { return -1 }
+
+func (s *fakeSQLStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	q := s.query
+	if m := fakeCreateTable.FindStringSubmatch(q); m != nil {
+		if _, ok := s.db.tables[m[1]]; !ok {
+			s.db.tables[m[1]] = &fakeSQLTable{keys: splitColumns(m[2])}
+		}
+		return driver.RowsAffected(0), nil
+	}
+
+	if m := fakeCreateIndex.FindStringSubmatch(q); m != nil {
+		if s.db.indexes[m[2]] && m[1] == "" {
+			return nil, fmt.Errorf("duplicate key name %s", m[2])
+		}
+		s.db.indexes[m[2]] = true
+		return driver.RowsAffected(0), nil
+	}
+
+	if m := fakeInsert.FindStringSubmatch(q); m != nil {
+		table, err := s.db.table(m[1])
+		if err != nil {
+			return nil, err
+		}
+
+		columns := splitColumns(m[2])
+		row := map[string]driver.Value{}
+		for i, c := range columns {
+			row[c] = args[i]
+		}
+
+		for i, old := range table.rows {
+			if table.sameKey(old, row) {
+				if m[3] == "" {
+					return nil, fmt.Errorf("duplicate key in %s", m[1])
+				}
+				table.rows[i] = row
+				return driver.RowsAffected(1), nil
+			}
+		}
+
+		table.rows = append(table.rows, row)
+		return driver.RowsAffected(1), nil
+	}
+
+	if m := fakeDelete.FindStringSubmatch(q); m != nil {
+		table, err := s.db.table(m[1])
+		if err != nil {
+			return nil, err
+		}
+
+		keep := table.rows[:0]
+		var count int64
+		for _, row := range table.rows {
+			ok, err := fakeMatch(row, m[2], args)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				count++
+				continue
+			}
+			keep = append(keep, row)
+		}
+		table.rows = keep
+		return driver.RowsAffected(count), nil
+	}
+
+	return nil, fmt.Errorf("fake sql not support: %s", q)
+}
+
+func (s *fakeSQLStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	// last arg is index name
+	if fakeIndexExist.MatchString(s.query) {
+		var count int64
+		if s.db.indexes[fmt.Sprint(args[len(args)-1])] {
+			count = 1
+		}
+		return &fakeSQLRows{columns: []string{"count"}, rows: [][]driver.Value{{count}}}, nil
+	}
+
+	m := fakeSelect.FindStringSubmatch(s.query)
+	if m == nil {
+		return nil, fmt.Errorf("fake sql not support: %s", s.query)
+	}
+
+	table, err := s.db.table(m[2])
+	if err != nil {
+		return nil, err
+	}
+
+	columns := splitColumns(m[1])
+	result := &fakeSQLRows{columns: columns}
+	for _, row := range table.rows {
+		ok, err := fakeMatch(row, m[3], args)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		values := make([]driver.Value, 0, len(columns))
+		for _, c := range columns {
+			values = append(values, row[c])
+		}
+		result.rows = append(result.rows, values)
+	}
+
+	return result, nil
+}
+
+func (db *fakeSQLDB) table(name string) (*fakeSQLTable, error) {
+	table, ok := db.tables[name]
+	if !ok {
+		return nil, fmt.Errorf("no such table: %s", name)
+	}
+	return table, nil
+}
+
+func (t *fakeSQLTable) sameKey(a, b map[string]driver.Value) bool {
+	for _, k := range t.keys {
+		if a[k] != b[k] {
+			return false
+		}
+	}
+	return true
+}
+
+// conditions join by AND, each is column op ?
+func fakeMatch(row map[string]driver.Value, where string, args []driver.Value) (bool, error) {
+	if where == "" {
+		return true, nil
+	}
+
+	for i, condition := range strings.Split(where, " AND ") {
+		m := fakeCondition.FindStringSubmatch(condition)
+		if m == nil || i >= len(args) {
+			return false, fmt.Errorf("fake sql condition not support: %s", condition)
+		}
+
+		value, arg := row[m[1]], args[i]
+		switch m[2] {
+		case "=":
+			if value != arg {
+				return false, nil
+			}
+		case ">", "<=":
+			a, okA := value.(int64)
+			b, okB := arg.(int64)
+			if !okA || !okB {
+				return false, errors.New("fake sql compare not int")
+			}
+			if (m[2] == ">") != (a > b) {
+				return false, nil
+			}
+		}
+	}
+
+	return true, nil
+}
+
+func splitColumns(s string) []string {
+	columns := strings.Split(s, ",")
+	for i := range columns {
+		columns[i] = strings.TrimSpace(columns[i])
+	}
+	return columns
+}
+
+type fakeSQLRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeSQLRows) Columns() []string { return r.columns }
+func (r *fakeSQLRows) Close() error      { return nil }
+
+func (r *fakeSQLRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func newFakeSQLSession(t *testing.T) (*SQLSession, *fakeSQLDB) {
+	// fresh database every run, so -count not see the last one
+	name := t.Name() + "-" + GetGUID()
+	db, err := sql.Open("gosession-fake", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewSQLSession(db, DialectSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s.(*SQLSession), fakeSQL.dbs[name]
+}
+
+func TestSQLSessionMigrate(t *testing.T) {
+	s, fake := newFakeSQLSession(t)
+	for _, table := range []string{sqlTokenTable, sqlUserTokenTable, sqlUserTable, sqlMigrationTable} {
+		if _, ok := fake.tables[table]; !ok {
+			t.Fatalf("table %s not created", table)
+		}
+	}
+
+	indexes := len(fake.indexes)
+	if indexes == 0 {
+		t.Fatal("index not created")
+	}
+
+	// applied version not run again
+	err := s.Migrate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fake.indexes) != indexes || len(fake.tables[sqlMigrationTable].rows) != len(sqlMigrations) {
+		t.Fatal("migration should only apply once")
+	}
+}
+
+func TestSQLSessionMigrateMySQL(t *testing.T) {
+	name := t.Name() + "-" + GetGUID()
+	db, err := sql.Open("gosession-fake", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// half applied, DDL committed but version not recorded
+	for _, statement := range sqlMigrations[0].statements {
+		if _, err = db.Exec(statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	index := sqlMigrations[0].indexes[0]
+	_, err = db.Exec(fmt.Sprintf("CREATE INDEX %s ON %s (%s)", index.name, index.table, index.columns))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tm, err := NewSQLSession(db, DialectMySQL)
+	if err != nil {
+		t.Fatalf("migrate after half applied: %v", err)
+	}
+
+	// many instance start together
+	s := tm.(*SQLSession)
+	fake := fakeSQL.dbs[name]
+	fake.mu.Lock()
+	fake.tables[sqlMigrationTable].rows = nil
+	fake.mu.Unlock()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- s.Migrate()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("migrate again: %v", err)
+		}
+	}
+
+	if len(fake.indexes) != len(sqlMigrations[0].indexes) || len(fake.tables[sqlMigrationTable].rows) != len(sqlMigrations) {
+		t.Fatalf("index %v, version %d", fake.indexes, len(fake.tables[sqlMigrationTable].rows))
+	}
+}
+
+func TestSQLSessionToken(t *testing.T) {
+	s, fake := newFakeSQLSession(t)
+	s.ConfigGetUserInfoFunc(func(id string) (*User, error) {
+		if id == "404" {
+			return nil, ErrUserNotFound
+		}
+		return &User{Id: id, Detail: "detail " + id}, nil
+	})
+
+	var events []EventType
+	s.AddEventListener(EventListenerFunc(func(event *Event) { events = append(events, event.Type) }), false)
+
+	token, err := s.SetToken("1", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, exist, err := s.CheckTokenOrUpdateUser(token, 100)
+	if err != nil || !exist || user.Id != "1" || user.Detail != "detail 1" || user.Token != token || user.TokenRemainLiveTime <= 0 {
+		t.Fatalf("check token: %#v %v %v", user, exist, err)
+	}
+
+	// user info from cache table
+	s.ConfigGetUserInfoFunc(func(id string) (*User, error) { return nil, errors.New("should not load") })
+	user, exist, err = s.CheckTokenOrUpdateUser(token, 100)
+	if err != nil || !exist || user.Detail != "detail 1" {
+		t.Fatalf("check token by cache: %#v %v %v", user, exist, err)
+	}
+
+	token2, err := s.SetToken("1", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokens, err := s.ListUserToken("1")
+	if err != nil || len(tokens) != 2 {
+		t.Fatalf("list token: %v %v", tokens, err)
+	}
+
+	err = s.DeleteToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, exist, err = s.CheckToken(token)
+	if err != nil || exist {
+		t.Fatalf("deleted token should not exist: %v %v", exist, err)
+	}
+
+	err = s.DeleteUserToken("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, exist, err = s.CheckToken(token2)
+	if err != nil || exist {
+		t.Fatalf("token of deleted user should not exist: %v %v", exist, err)
+	}
+
+	// single mode evict others
+	s.SetSingleMode()
+	token3, _ := s.SetToken("2", 100)
+	token4, _ := s.SetToken("2", 100)
+	if _, exist, _ := s.CheckToken(token3); exist {
+		t.Fatal("single mode should evict old token")
+	}
+	if _, exist, _ := s.CheckToken(token4); !exist {
+		t.Fatal("single mode new token should exist")
+	}
+
+	want := []EventType{EventLogin, EventLogin, EventLogout, EventLogout, EventRevokeAll, EventLogin, EventEvict, EventLogin}
+	if fmt.Sprint(events) != fmt.Sprint(want) {
+		t.Fatalf("events %v, want %v", events, want)
+	}
+
+	// expire by expires_at and purge
+	err = s.RefreshToken(token4, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, row := range fake.tables[sqlTokenTable].rows {
+		row["expires_at"] = time.Now().Unix() - 1
+	}
+
+	tokens, err = s.ListUserToken("2")
+	if err != nil || len(tokens) != 1 {
+		t.Fatalf("user token table not expire yet: %v %v", tokens, err)
+	}
+
+	count, err := s.Purge()
+	if err != nil || count != 1 {
+		t.Fatalf("purge: %d %v", count, err)
+	}
+
+	if _, exist, _ := s.CheckToken(token4); exist {
+		t.Fatal("purged token should not exist")
+	}
+}
+
+func TestSQLSessionDialect(t *testing.T) {
+	mysql := &SQLSession{dialect: DialectMySQL}
+	postgres := &SQLSession{dialect: DialectPostgres}
+
+	got := mysql.upsert("t", []string{"a", "b"}, []string{"a"}, []string{"b"})
+	if got != "INSERT INTO t (a, b) VALUES (?, ?) ON DUPLICATE KEY UPDATE b = VALUES(b)" {
+		t.Fatalf("mysql upsert: %s", got)
+	}
+
+	got = postgres.upsert("t", []string{"a", "b"}, []string{"a"}, []string{"b"})
+	if got != "INSERT INTO t (a, b) VALUES ($1, $2) ON CONFLICT (a) DO UPDATE SET b = excluded.b" {
+		t.Fatalf("postgres upsert: %s", got)
+	}
+
+	if _, err := NewSQLSession(nil, DialectSQLite); err == nil {
+		t.Fatal("nil db should fail")
+	}
+}
@@ -0,0 +1,430 @@
+package gosession
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// StoreToken one token in store
+type StoreToken struct {
+	Token      string `json:"token"`
+	UserId     string `json:"user_id"`
+	CreateTime int64  `json:"create_time"` // unix second when set
+	ExpiresAt  int64  `json:"expires_at"`  // unix second when expire
+
+	Meta map[string]string `json:"meta,omitempty"` // custom metadata of token, carry over by refresh
+}
+
+// Store the primitive of storage, it is extension point for new lite backend, StoreSession build token and
+// user semantics such single mode, max session, metadata and event on it, so new backend only need implement this.
+// Expired token and user should not be returned, backend can clean them lazy.
+// It is not the core of shipped session: RedisSession, SQLSession and FileSession keep their own implementation
+// and not build on it, so policy is not shared with them, and policy only in RedisSession such
+// ExpirePolicy, binding, scopes, ban, auth level, rotation, impersonation and tenant not support by StoreSession.
+type Store interface {
+	PutToken(token *StoreToken) error                             // Put token and add it to list of user at once, replace if exist, expired one can return error
+	GetToken(token string) (*StoreToken, bool, error)             // Get token, not exist or expired return false
+	DeleteToken(userId string, token string) error                // Delete token and remove it from list of user at once
+	ListUserToken(userId string) ([]*StoreToken, error)           // List all live token of user
+	GetUser(userId string) (detail []byte, exist bool, err error) // Get user info cache
+	SetUser(userId string, detail []byte, expiresAt int64) error  // Set user info cache, expire at unix second
+	DeleteUser(userId string) error                               // Delete user info cache
+}
+
+// StoreSession session on any Store
+type StoreSession struct {
+	store        Store                          // where token and user save
+	getUserFunc  func(id string) (*User, error) // when not hit cache will get user from this func
+	expireTime   int64                          // token expire how much second，default  7 days
+	isSingleMode bool                           // is single token, new token will destroy other token
+	maxSession   int                            // at most how many token of user, oldest will be evicted, 0 means no limit
+	events       *eventHub                      // session event listener
+	clock        Clock                          // where get now, nil means SystemClock
+}
+
+// NewStoreSession new a session on store
+func NewStoreSession(store Store) (TokenManage, error) {
+	if store == nil {
+		return nil, errors.New("store is nil")
+	}
+
+	return &StoreSession{
+		store:      store,
+		expireTime: expireTimeDefault,
+		events:     newEventHub(),
+	}, nil
+}
+
+// ConfigMaxSession config by chain, at most n token of user, the oldest will be evicted when new token set, n <= 0 means no limit
+func (s *StoreSession) ConfigMaxSession(n int) TokenManage {
+	if n < 0 {
+		n = 0
+	}
+	s.maxSession = n
+	return s
+}
+
+// ConfigTokenKeyPrefix config by chain, key is decided by store, nothing to do
+func (s *StoreSession) ConfigTokenKeyPrefix(tokenKey string) TokenManage {
+	return s
+}
+
+// ConfigUserKeyPrefix config by chain, key is decided by store, nothing to do
+func (s *StoreSession) ConfigUserKeyPrefix(userKey string) TokenManage {
+	return s
+}
+
+// ConfigDefaultExpireTime config by chain
+func (s *StoreSession) ConfigDefaultExpireTime(second int64) TokenManage {
+	if second > 0 {
+		s.expireTime = second
+	}
+	return s
+}
+
+// ConfigGetUserInfoFunc config by chain
+func (s *StoreSession) ConfigGetUserInfoFunc(fn GetUserInfoFunc) TokenManage {
+	s.getUserFunc = fn
+	return s
+}
+
+// AddEventListener config by chain
+func (s *StoreSession) AddEventListener(listener EventListener, async bool) TokenManage {
+	s.events.add(listener, async)
+	return s
+}
+
+// SetSingleMode config by chain
+func (s *StoreSession) SetSingleMode() TokenManage {
+	s.isSingleMode = true
+	return s
+}
+
+// SetToken Set token, expire after some second
+func (s *StoreSession) SetToken(userId string, tokenValidTimes int64) (token string, err error) {
+	return s.setToken(userId, tokenValidTimes, nil)
+}
+
+// SetTokenWithMeta Set token with custom metadata such device or client, get it back by check in User.Meta
+func (s *StoreSession) SetTokenWithMeta(userId string, tokenValidTimes int64, meta map[string]string) (token string, err error) {
+	if len(meta) == 0 {
+		err = errors.New("meta empty")
+		return
+	}
+
+	return s.setToken(userId, tokenValidTimes, meta)
+}
+
+// set token with meta, nil meta means none
+func (s *StoreSession) setToken(userId string, tokenValidTimes int64, meta map[string]string) (token string, err error) {
+	if userId == "" {
+		err = errors.New("user id nil")
+		return
+	}
+
+	if tokenValidTimes <= 0 {
+		tokenValidTimes = s.expireTime
+	}
+
+	// if single, destroy other token first
+	if s.isSingleMode {
+		err = s.deleteUserToken(userId, EventEvict, "single mode")
+		if err != nil {
+			return "", err
+		}
+	} else if s.maxSession > 0 {
+		err = s.evictOldest(userId, s.maxSession-1)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	now := s.now().Unix()
+	token = fmt.Sprintf("%s_%s", userId, GetGUID())
+	err = s.store.PutToken(&StoreToken{Token: token, UserId: userId, CreateTime: now, ExpiresAt: now + tokenValidTimes, Meta: copyMeta(meta)})
+	if err != nil {
+		return "", err
+	}
+
+	s.emit(EventLogin, userId, token, tokenValidTimes, "")
+	return token, nil
+}
+
+// evict the oldest token of user, keep at most n
+func (s *StoreSession) evictOldest(userId string, n int) error {
+	tokens, err := s.store.ListUserToken(userId)
+	if err != nil {
+		return err
+	}
+
+	if len(tokens) <= n {
+		return nil
+	}
+
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].CreateTime < tokens[j].CreateTime })
+	for _, t := range tokens[:len(tokens)-n] {
+		err = s.store.DeleteToken(userId, t.Token)
+		if err != nil {
+			return err
+		}
+
+		s.emit(EventEvict, userId, t.Token, 0, "max session")
+	}
+
+	return nil
+}
+
+// RefreshToken Refresh token，token expire will be again after some second, not exist will set a new one
+func (s *StoreSession) RefreshToken(token string, tokenValidTimes int64) (err error) {
+	userId, err := tokenUserId(token)
+	if err != nil {
+		return err
+	}
+
+	if tokenValidTimes <= 0 {
+		tokenValidTimes = s.expireTime
+	}
+
+	now := s.now().Unix()
+	t, exist, err := s.store.GetToken(token)
+	if err != nil {
+		return err
+	}
+
+	if !exist {
+		t = &StoreToken{Token: token, UserId: userId, CreateTime: now}
+	}
+
+	t.ExpiresAt = now + tokenValidTimes
+	err = s.store.PutToken(t)
+	if err != nil {
+		return err
+	}
+
+	s.emit(EventRefresh, userId, token, tokenValidTimes, "")
+	return nil
+}
+
+// DeleteToken Delete token when you do action such logout
+func (s *StoreSession) DeleteToken(token string) (err error) {
+	userId, err := tokenUserId(token)
+	if err != nil {
+		return err
+	}
+
+	_, exist, err := s.store.GetToken(token)
+	if err != nil || !exist {
+		return err
+	}
+
+	err = s.store.DeleteToken(userId, token)
+	if err != nil {
+		return err
+	}
+
+	s.emit(EventLogout, userId, token, 0, "delete token")
+	return nil
+}
+
+// CheckToken Check the token, but not refresh user info cache
+func (s *StoreSession) CheckToken(token string) (user *User, exist bool, err error) {
+	return s.CheckTokenOrUpdateUser(token, -1)
+}
+
+// CheckTokenOrUpdateUser Check the token, when user info cache exist return directly,
+// others load by getUserFunc and save in cache, if s.getUserFunc == nil do nothing
+func (s *StoreSession) CheckTokenOrUpdateUser(token string, userInfoValidTimes int64) (user *User, exist bool, err error) {
+	userId, err := tokenUserId(token)
+	if err != nil {
+		return nil, false, err
+	}
+
+	now := s.now().Unix()
+	t, exist, err := s.store.GetToken(token)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !exist || t.UserId != userId || t.ExpiresAt <= now {
+		return nil, false, nil
+	}
+
+	if s.getUserFunc == nil || userInfoValidTimes < 0 {
+		user = new(User)
+		user.Id = userId
+	} else {
+		detail, cached, err := s.store.GetUser(userId)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if cached {
+			user = new(User)
+			err = json.Unmarshal(detail, user)
+			if err != nil {
+				return nil, false, err
+			}
+			user.Id = userId
+		} else {
+			user, exist, err = s.AddUser(userId, userInfoValidTimes)
+			if err != nil || !exist {
+				return nil, false, err
+			}
+		}
+	}
+
+	user.Token = token
+	user.TokenRemainLiveTime = t.ExpiresAt - now
+	user.TokenExpireTime = t.ExpiresAt
+	user.Meta = copyMeta(t.Meta)
+	return user, true, nil
+}
+
+// ListUserToken List all live token in one user
+func (s *StoreSession) ListUserToken(userId string) ([]string, error) {
+	if userId == "" {
+		return nil, errors.New("user id empty")
+	}
+
+	tokens, err := s.store.ListUserToken(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now().Unix()
+	result := make([]string, 0, len(tokens))
+	for _, t := range tokens {
+		if t.ExpiresAt > now {
+			result = append(result, t.Token)
+		}
+	}
+
+	return result, nil
+}
+
+// DeleteUserToken Delete all token of this user
+func (s *StoreSession) DeleteUserToken(userId string) (err error) {
+	err = s.deleteUserToken(userId, EventLogout, "delete user token")
+	if err != nil {
+		return err
+	}
+
+	s.emit(EventRevokeAll, userId, "", 0, "delete user token")
+	return nil
+}
+
+// delete all token of this user, every token will emit event eventType
+func (s *StoreSession) deleteUserToken(userId string, eventType EventType, reason string) (err error) {
+	tokens, err := s.ListUserToken(userId)
+	if err != nil {
+		return err
+	}
+
+	for _, token := range tokens {
+		err = s.store.DeleteToken(userId, token)
+		if err != nil {
+			return err
+		}
+
+		s.emit(eventType, userId, token, 0, reason)
+	}
+
+	return nil
+}
+
+// RefreshUser Refresh cache of user info batch
+func (s *StoreSession) RefreshUser(ids []string, userInfoValidTimes int64) (err error) {
+	for _, id := range ids {
+		_, _, err = s.AddUser(id, userInfoValidTimes)
+		if err != nil {
+			return err
+		}
+
+		// cache fill by check not emit, only here and DeleteUser
+		s.emit(EventUserUpdated, id, "", 0, "refresh user")
+	}
+
+	return nil
+}
+
+// DeleteUser Delete user info in cache
+func (s *StoreSession) DeleteUser(userId string) (err error) {
+	if userId == "" {
+		err = errors.New("user id empty")
+		return
+	}
+
+	err = s.store.DeleteUser(userId)
+	if err != nil {
+		return err
+	}
+
+	s.emit(EventUserUpdated, userId, "", 0, "delete user")
+	return nil
+}
+
+// AddUser Add the user info to cache，expire after some second
+func (s *StoreSession) AddUser(userId string, userInfoValidTimes int64) (user *User, exist bool, err error) {
+	if s.getUserFunc == nil {
+		return nil, false, errors.New("getUserFunc nil")
+	}
+
+	if userId == "" {
+		err = errors.New("user id empty")
+		return
+	}
+
+	user, err = s.getUserFunc(userId)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	if user == nil {
+		user = new(User)
+	}
+
+	user.Id = userId
+
+	raw, err := json.Marshal(user)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if userInfoValidTimes <= 0 {
+		userInfoValidTimes = s.expireTime
+	}
+
+	err = s.store.SetUser(userId, raw, s.now().Unix()+userInfoValidTimes)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return user, true, nil
+}
+
+// EventDropped how many event dropped because queue of async listener full
+func (s *StoreSession) EventDropped() int64 {
+	return s.events.droppedCount()
+}
+
+// emit session event to listener
+func (s *StoreSession) emit(eventType EventType, userId string, token string, ttl int64, reason string) {
+	s.events.emit(&Event{Type: eventType, UserId: userId, Token: token, TTL: ttl, Reason: reason})
+}
+
+// copy meta so caller change not affect the stored one, empty return nil
+func copyMeta(meta map[string]string) map[string]string {
+	if len(meta) == 0 {
+		return nil
+	}
+
+	result := make(map[string]string, len(meta))
+	for k, v := range meta {
+		result[k] = v
+	}
+	return result
+}
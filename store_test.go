@@ -0,0 +1,205 @@
+package gosession
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStoreSessionMemory(t *testing.T) {
+	tm, err := NewStoreSession(NewMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var evicted []string
+	s := tm.(*StoreSession)
+	s.ConfigMaxSession(2)
+	s.AddEventListener(EventListenerFunc(func(event *Event) {
+		if event.Type == EventEvict {
+			evicted = append(evicted, event.Token)
+		}
+	}), false)
+	s.ConfigGetUserInfoFunc(func(id string) (*User, error) { return &User{Detail: "detail " + id}, nil })
+
+	// older one
+	token1 := "1_old"
+	_ = s.store.PutToken(&StoreToken{Token: token1, UserId: "1", CreateTime: time.Now().Unix() - 10, ExpiresAt: time.Now().Unix() + 100})
+	token2, _ := s.SetToken("1", 100)
+	token3, err := s.SetToken("1", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(evicted) != 1 || evicted[0] != token1 {
+		t.Fatalf("oldest token should be evicted: %v", evicted)
+	}
+
+	if tokens, _ := s.ListUserToken("1"); len(tokens) != 2 {
+		t.Fatalf("should keep 2 token: %v", tokens)
+	}
+
+	user, exist, err := s.CheckTokenOrUpdateUser(token2, 100)
+	if err != nil || !exist || user.Detail != "detail 1" || user.Token != token2 {
+		t.Fatalf("check token wrong: %#v %v %v", user, exist, err)
+	}
+
+	if _, exist, _ = s.CheckToken(token1); exist {
+		t.Fatal("evicted token should not exist")
+	}
+
+	s.SetSingleMode()
+	token4, _ := s.SetToken("1", 100)
+	if tokens, _ := s.ListUserToken("1"); len(tokens) != 1 || tokens[0] != token4 {
+		t.Fatalf("single mode should keep new token only: %v", tokens)
+	}
+
+	if _, exist, _ = s.CheckToken(token3); exist {
+		t.Fatal("token should be evicted by single mode")
+	}
+}
+
+func TestMemoryStoreExpire(t *testing.T) {
+	m := NewMemoryStore()
+	now := time.Now().Unix()
+	_ = m.PutToken(&StoreToken{Token: "1_a", UserId: "1", CreateTime: now, ExpiresAt: now - 1})
+	_ = m.PutToken(&StoreToken{Token: "1_b", UserId: "1", CreateTime: now, ExpiresAt: now + 100})
+
+	if _, exist, _ := m.GetToken("1_a"); exist {
+		t.Fatal("expired token should not get")
+	}
+
+	tokens, _ := m.ListUserToken("1")
+	if len(tokens) != 1 || tokens[0].Token != "1_b" {
+		t.Fatalf("list should skip expired: %v", tokens)
+	}
+
+	_ = m.SetUser("1", []byte("{}"), now-1)
+	if _, exist, _ := m.GetUser("1"); exist {
+		t.Fatal("expired user should not get")
+	}
+}
+
+func TestStoreSessionMeta(t *testing.T) {
+	tm, err := NewStoreSession(NewMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := tm.(*StoreSession)
+
+	if _, err = s.SetTokenWithMeta("1", 100, nil); err == nil {
+		t.Fatal("empty meta should fail")
+	}
+
+	meta := map[string]string{"device": "ios"}
+	token, err := s.SetTokenWithMeta("1", 100, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta["device"] = "changed"
+
+	// carry over by refresh
+	if err = s.RefreshToken(token, 200); err != nil {
+		t.Fatal(err)
+	}
+
+	user, exist, err := s.CheckToken(token)
+	if err != nil || !exist || user.Meta["device"] != "ios" {
+		t.Fatalf("meta wrong: %#v %v %v", user, exist, err)
+	}
+
+	other, _ := s.SetToken("1", 100)
+	if user, _, _ = s.CheckToken(other); user.Meta != nil {
+		t.Fatalf("token without meta: %v", user.Meta)
+	}
+}
+
+func TestStoreSessionClock(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	m := NewMemoryStore()
+	r := &RedisStore{}
+
+	for _, store := range []Store{m, r} {
+		tm, err := NewStoreSession(store)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tm.(*StoreSession).ConfigClock(clock)
+	}
+
+	if m.clock != clock || r.clock != clock {
+		t.Fatal("clock of shipped store should follow the session")
+	}
+}
+
+// redis store for behavior test, skip when redis not running
+func newTestRedisStore(t *testing.T) *RedisStore {
+	t.Helper()
+	rs := newTestRedisSession(t)
+	r, err := NewRedisStore(rs.pool, strings.TrimSuffix(rs.tokenKey, "-token")+"-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestRedisStore(t *testing.T) {
+	r := newTestRedisStore(t)
+	now := time.Now().Unix()
+
+	if err := r.PutToken(&StoreToken{Token: "1_a", UserId: "1", CreateTime: now, ExpiresAt: now}); !errors.Is(err, ErrTokenExpired) {
+		t.Fatalf("put expired token should fail: %v", err)
+	}
+
+	if _, exist, _ := r.GetToken("1_a"); exist {
+		t.Fatal("expired token should not put")
+	}
+
+	err := r.PutToken(&StoreToken{Token: "1_b", UserId: "1", CreateTime: now, ExpiresAt: now + 100, Meta: map[string]string{"device": "ios"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, exist, err := r.GetToken("1_b")
+	if err != nil || !exist || token.UserId != "1" || token.ExpiresAt != now+100 || token.Meta["device"] != "ios" {
+		t.Fatalf("get token: %#v %v %v", token, exist, err)
+	}
+
+	_ = r.PutToken(&StoreToken{Token: "1_c", UserId: "1", CreateTime: now, ExpiresAt: now + 1})
+	time.Sleep(2100 * time.Millisecond)
+
+	// expired one in list removed
+	tokens, err := r.ListUserToken("1")
+	if err != nil || len(tokens) != 1 || tokens[0].Token != "1_b" {
+		t.Fatalf("list token: %v %v", tokens, err)
+	}
+
+	if err = r.DeleteToken("1", "1_b"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, exist, _ = r.GetToken("1_b"); exist {
+		t.Fatal("deleted token should not exist")
+	}
+
+	if tokens, _ = r.ListUserToken("1"); len(tokens) != 0 {
+		t.Fatalf("list after delete: %v", tokens)
+	}
+
+	if err = r.SetUser("1", []byte(`{"id":"1"}`), time.Now().Unix()+100); err != nil {
+		t.Fatal(err)
+	}
+
+	if detail, exist, err := r.GetUser("1"); err != nil || !exist || string(detail) != `{"id":"1"}` {
+		t.Fatalf("get user: %s %v %v", detail, exist, err)
+	}
+
+	if err = r.DeleteUser("1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, exist, _ = r.GetUser("1"); exist {
+		t.Fatal("deleted user should not exist")
+	}
+}
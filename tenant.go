@@ -0,0 +1,138 @@
+package gosession
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// ForTenant the view of session for tenant, token key, user key and token map of it are namespaced,
+// so the same user id in different tenant not conflict. Call it again return the same view.
+// The view copy the config of root when first call, then config chain of view such ConfigDefaultExpireTime,
+// SetSingleMode only work for the tenant. Local cache and presence not copy, config them on view if need.
+// Event of view dispatch to its own listener, then to listener of root with TenantId,
+// presence of root skip event of tenant, config presence on view to count the tenant.
+func (s *RedisSession) ForTenant(tenantId string) (TokenManage, error) {
+	view, err := s.forTenant(tenantId)
+	if err != nil {
+		return nil, err
+	}
+	return view, nil
+}
+
+func (s *RedisSession) forTenant(tenantId string) (*RedisSession, error) {
+	if s.tenantId != "" {
+		return nil, errors.New("already tenant view")
+	}
+
+	err := checkTenantId(tenantId)
+	if err != nil {
+		return nil, err
+	}
+
+	if view, ok := s.tenants.Load(tenantId); ok {
+		return view.(*RedisSession), nil
+	}
+
+	// shallow copy, then replace the state should not share
+	view := *s
+	view.tenantId = tenantId
+	view.tokenKey = s.tenantKeyPrefix(s.tokenKey, tenantId)
+	view.userKey = s.tenantKeyPrefix(s.userKey, tenantId)
+	view.userRefreshing = new(sync.Map)
+	view.localCache = nil
+	view.localCacheCancel = nil
+	view.localCacheTracking = false
+	view.eventPublisher = nil
+	view.janitor = new(redisJanitor)
+	view.presenceWindow = 0
+	view.presenceListen = false
+	view.presenceTouched = new(sync.Map)
+
+	// listener of view see the tenant id too, root only forward it
+	root := s.events
+	view.events = newEventHub()
+	view.events.tenantId = tenantId
+	view.events.clock = s.events.clock
+	view.events.add(EventListenerFunc(func(event *Event) {
+		root.emit(event)
+	}), false)
+
+	actual, _ := s.tenants.LoadOrStore(tenantId, &view)
+	return actual.(*RedisSession), nil
+}
+
+// TenantId tenant of this view, empty means root
+func (s *RedisSession) TenantId() string {
+	return s.tenantId
+}
+
+// PurgeTenant delete all key of tenant such token, user info cache, and forget the view,
+// it SCAN the key so maybe slow, token set at the same time may survive
+func (s *RedisSession) PurgeTenant(tenantId string) (count int64, err error) {
+	if s.tenantId != "" {
+		return 0, errors.New("purge tenant only by root")
+	}
+
+	err = checkTenantId(tenantId)
+	if err != nil {
+		return 0, err
+	}
+
+	if v, ok := s.tenants.LoadAndDelete(tenantId); ok {
+		view := v.(*RedisSession)
+		view.StopJanitor()
+		if view.localCacheCancel != nil {
+			view.localCacheCancel()
+		}
+	}
+
+	config := fixJanitorConfig(JanitorConfig{})
+	prefixes := []string{s.tenantKeyPrefix(s.tokenKey, tenantId)}
+	if userPrefix := s.tenantKeyPrefix(s.userKey, tenantId); userPrefix != prefixes[0] {
+		prefixes = append(prefixes, userPrefix)
+	}
+
+	for _, prefix := range prefixes {
+		// key of tenant is prefix_xxx or prefix-xxx, tenant id has no - so not match other tenant
+		for _, match := range []string{escapeGlob(prefix) + "_*", escapeGlob(prefix) + "-*"} {
+			err = s.scan(context.Background(), match, config, func(conn redis.Conn, key string) error {
+				deleted, err := redis.Int64(conn.Do("DEL", key))
+				if err != nil {
+					return err
+				}
+
+				count += deleted
+				return nil
+			})
+			if err != nil {
+				return count, err
+			}
+		}
+	}
+
+	return count, nil
+}
+
+// tenant id only letter and digit, so key of one tenant can be matched by prefix
+func checkTenantId(tenantId string) error {
+	if tenantId == "" {
+		return errors.New("tenant id empty")
+	}
+
+	for _, c := range tenantId {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return fmt.Errorf("tenant id can only be letter or digit: %s", tenantId)
+		}
+	}
+
+	return nil
+}
+
+// key prefix of tenant
+func (s *RedisSession) tenantKeyPrefix(prefix string, tenantId string) string {
+	return fmt.Sprintf("%s-tenant-%s", prefix, tenantId)
+}
@@ -0,0 +1,47 @@
+package gosession
+
+import (
+	"testing"
+)
+
+func TestForTenant(t *testing.T) {
+	s := newRedisSession(nil, tokenKeyDefault, userKeyDefault, expireTimeDefault)
+
+	for _, id := range []string{"", "a_b", "a-b", "a*"} {
+		if _, err := s.ForTenant(id); err == nil {
+			t.Fatalf("tenant id %q should fail", id)
+		}
+	}
+
+	a, err := s.forTenant("acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.TenantId() != "acme" || a.tokenKey != "gosession-token-tenant-acme" || a.userKey != "gosession-user-tenant-acme" {
+		t.Fatalf("tenant view wrong: %s %s %s", a.TenantId(), a.tokenKey, a.userKey)
+	}
+
+	// the same view, config only for tenant
+	a.ConfigDefaultExpireTime(60).SetSingleMode()
+	again, _ := s.forTenant("acme")
+	if again != a || !again.isSingleMode || again.expireTime != 60 {
+		t.Fatal("tenant view should be the same")
+	}
+
+	if s.isSingleMode || s.expireTime != expireTimeDefault {
+		t.Fatal("root config should not change")
+	}
+
+	if _, err := a.ForTenant("other"); err == nil {
+		t.Fatal("view of view should fail")
+	}
+
+	// event go to root with tenant id
+	var got *Event
+	s.AddEventListener(EventListenerFunc(func(event *Event) { got = event }), false)
+	a.emit(EventLogin, "1001", "1001_a", 60, "")
+	if got == nil || got.TenantId != "acme" || got.UserId != "1001" {
+		t.Fatalf("root should receive tenant event: %+v", got)
+	}
+}
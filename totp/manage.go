@@ -0,0 +1,147 @@
+package totp
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+// RecoveryCodeSize random bytes of one recovery code
+var RecoveryCodeSize = 10
+
+// Store record last used time step and recovery code hash of user, such redis,
+// gosession.RedisSession.TOTPStore() is one which use the same redis of session
+type Store interface {
+	AdvanceStep(userId string, step int64, ttl int64) (ok bool, err error) // Save step as last used step of user only when it greater than the last one atomic, false when not, forget after ttl second
+	SetRecoveryCodes(userId string, hashes []string) error                 // Replace all recovery code hash of user
+	UseRecoveryCode(userId string, hash string) (ok bool, err error)       // Delete the recovery code hash of user, false when not exist
+}
+
+// Manage verify totp code of user, every code can only use once
+type Manage struct {
+	Config Config
+	Store  Store
+}
+
+// NewManage new manage with store
+func NewManage(store Store, config Config) (*Manage, error) {
+	if store == nil {
+		return nil, errors.New("totp store nil")
+	}
+
+	config = config.fix()
+	if _, err := config.hash(); err != nil {
+		return nil, err
+	}
+
+	return &Manage{Config: config, Store: store}, nil
+}
+
+// Verify code of user by its secret, return ErrCodeReplay when the same or later time step verified before,
+// as RFC 6238 section 5.2, so code of earlier step in skew window not work after the later one used
+func (m *Manage) Verify(userId string, secret string, code string) (ok bool, err error) {
+	if userId == "" {
+		return false, errors.New("user id empty")
+	}
+
+	step, ok, err := Validate(secret, code, time.Now(), m.Config)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	// step not after the last one can not use, forget it when the last one out of the window
+	config := m.Config.fix()
+	advanced, err := m.Store.AdvanceStep(userId, step, (2*config.Skew+2)*config.Period)
+	if err != nil {
+		return false, err
+	}
+
+	if !advanced {
+		return false, ErrCodeReplay
+	}
+
+	return true, nil
+}
+
+// ResetRecoveryCodes gen n new recovery code of user, old one not work anymore,
+// only hash is stored, show the codes to user this time
+func (m *Manage) ResetRecoveryCodes(userId string, n int) (codes []string, err error) {
+	if userId == "" {
+		return nil, errors.New("user id empty")
+	}
+
+	codes, err = GenerateRecoveryCodes(n)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([]string, 0, len(codes))
+	for _, code := range codes {
+		hashes = append(hashes, HashRecoveryCode(code))
+	}
+
+	err = m.Store.SetRecoveryCodes(userId, hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// UseRecoveryCode check recovery code of user, it is deleted when ok so can only use once
+func (m *Manage) UseRecoveryCode(userId string, code string) (ok bool, err error) {
+	if userId == "" {
+		return false, errors.New("user id empty")
+	}
+
+	if normalizeRecoveryCode(code) == "" {
+		return false, nil
+	}
+
+	return m.Store.UseRecoveryCode(userId, HashRecoveryCode(code))
+}
+
+// GenerateRecoveryCodes gen n random recovery code such XXXXX-XXXXX-XXXXX-X
+func GenerateRecoveryCodes(n int) (codes []string, err error) {
+	if n <= 0 {
+		return nil, errors.New("recovery code number wrong")
+	}
+
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	codes = make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		raw := make([]byte, RecoveryCodeSize)
+		_, err = rand.Read(raw)
+		if err != nil {
+			return nil, err
+		}
+
+		code := encoding.EncodeToString(raw)
+		groups := make([]string, 0, len(code)/5+1)
+		for len(code) > 5 {
+			groups = append(groups, code[:5])
+			code = code[5:]
+		}
+		groups = append(groups, code)
+		codes = append(codes, strings.Join(groups, "-"))
+	}
+
+	return codes, nil
+}
+
+// HashRecoveryCode hash of recovery code to store, code is random enough so not need salt,
+// dash, space and lower case ignored
+func HashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(normalizeRecoveryCode(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.Replace(code, "-", "", -1)
+	code = strings.Replace(code, " ", "", -1)
+	return strings.ToUpper(code)
+}
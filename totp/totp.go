@@ -0,0 +1,187 @@
+// Package totp time-based one-time password (RFC 6238) for second factor of session,
+// secret generate, otpauth:// provisioning uri, code verify with drift window and replay prevent,
+// only standard library is used
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrCodeReplay the code of this time step used already
+	ErrCodeReplay = errors.New("totp code used already")
+
+	// SecretSize random bytes of secret, 20 bytes is 160 bits which RFC 4226 recommend
+	SecretSize = 20
+)
+
+// Algorithm hmac hash of totp, most authenticator app only support SHA1
+type Algorithm string
+
+const (
+	AlgorithmSHA1   Algorithm = "SHA1"
+	AlgorithmSHA256 Algorithm = "SHA256"
+	AlgorithmSHA512 Algorithm = "SHA512"
+)
+
+// Config config of totp, zero value use default
+type Config struct {
+	Digits    int       // code length, default 6
+	Period    int64     // second of one time step, default 30
+	Skew      int64     // how many time step before and after now also accept, default 0
+	Algorithm Algorithm // default SHA1
+}
+
+// fill default value
+func (c Config) fix() Config {
+	if c.Digits <= 0 {
+		c.Digits = 6
+	}
+
+	if c.Period <= 0 {
+		c.Period = 30
+	}
+
+	if c.Skew < 0 {
+		c.Skew = 0
+	}
+
+	if c.Algorithm == "" {
+		c.Algorithm = AlgorithmSHA1
+	}
+
+	return c
+}
+
+func (c Config) hash() (func() hash.Hash, error) {
+	switch c.Algorithm {
+	case AlgorithmSHA1:
+		return sha1.New, nil
+	case AlgorithmSHA256:
+		return sha256.New, nil
+	case AlgorithmSHA512:
+		return sha512.New, nil
+	}
+	return nil, fmt.Errorf("totp algorithm wrong: %s", c.Algorithm)
+}
+
+// GenerateSecret gen random secret, base32 without padding
+func GenerateSecret() (secret string, err error) {
+	raw := make([]byte, SecretSize)
+	_, err = rand.Read(raw)
+	if err != nil {
+		return "", err
+	}
+
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(raw), nil
+}
+
+// ProvisioningURI otpauth:// uri which can make QR code for authenticator app
+func ProvisioningURI(secret string, issuer string, account string, config Config) string {
+	config = config.fix()
+
+	label := url.PathEscape(account)
+	if issuer != "" {
+		label = url.PathEscape(issuer) + ":" + label
+	}
+
+	v := url.Values{}
+	v.Set("secret", strings.ToUpper(strings.TrimRight(secret, "=")))
+	if issuer != "" {
+		v.Set("issuer", issuer)
+	}
+	v.Set("algorithm", string(config.Algorithm))
+	v.Set("digits", fmt.Sprintf("%d", config.Digits))
+	v.Set("period", fmt.Sprintf("%d", config.Period))
+
+	return fmt.Sprintf("otpauth://totp/%s?%s", label, v.Encode())
+}
+
+// GenerateCode code of secret at time t
+func GenerateCode(secret string, t time.Time, config Config) (code string, err error) {
+	config = config.fix()
+	return generateCode(secret, t.Unix()/config.Period, config)
+}
+
+// Validate code of secret at time t, accept step in skew window, return which time step match
+func Validate(secret string, code string, t time.Time, config Config) (step int64, ok bool, err error) {
+	config = config.fix()
+	code = strings.TrimSpace(code)
+	if len(code) != config.Digits {
+		return 0, false, nil
+	}
+
+	now := t.Unix() / config.Period
+	for i := -config.Skew; i <= config.Skew; i++ {
+		expect, err := generateCode(secret, now+i, config)
+		if err != nil {
+			return 0, false, err
+		}
+
+		if subtle.ConstantTimeCompare([]byte(expect), []byte(code)) == 1 {
+			return now + i, true, nil
+		}
+	}
+
+	return 0, false, nil
+}
+
+// RFC 4226 HOTP of counter
+func generateCode(secret string, counter int64, config Config) (string, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+
+	fn, err := config.hash()
+	if err != nil {
+		return "", err
+	}
+
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(counter))
+
+	mac := hmac.New(fn, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	// dynamic truncation
+	offset := sum[len(sum)-1] & 0x0f
+	value := int64(binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff)
+
+	mod := int64(1)
+	for i := 0; i < config.Digits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", config.Digits, value%mod), nil
+}
+
+// secret is base32, space and padding and lower case allowed
+func decodeSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.Replace(secret, " ", "", -1))
+	secret = strings.TrimRight(secret, "=")
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		return nil, errors.New("totp secret wrong")
+	}
+
+	if len(key) == 0 {
+		return nil, errors.New("totp secret empty")
+	}
+
+	return key, nil
+}
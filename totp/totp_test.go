@@ -0,0 +1,196 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 Appendix B
+func TestGenerateCodeRFC6238(t *testing.T) {
+	secrets := map[Algorithm]string{
+		AlgorithmSHA1:   "12345678901234567890",
+		AlgorithmSHA256: "12345678901234567890123456789012",
+		AlgorithmSHA512: "1234567890123456789012345678901234567890123456789012345678901234",
+	}
+
+	cases := []struct {
+		unix  int64
+		codes map[Algorithm]string
+	}{
+		{59, map[Algorithm]string{AlgorithmSHA1: "94287082", AlgorithmSHA256: "46119246", AlgorithmSHA512: "90693936"}},
+		{1111111109, map[Algorithm]string{AlgorithmSHA1: "07081804", AlgorithmSHA256: "68084774", AlgorithmSHA512: "25091201"}},
+		{1111111111, map[Algorithm]string{AlgorithmSHA1: "14050471", AlgorithmSHA256: "67062674", AlgorithmSHA512: "99943326"}},
+		{1234567890, map[Algorithm]string{AlgorithmSHA1: "89005924", AlgorithmSHA256: "91819424", AlgorithmSHA512: "93441116"}},
+		{2000000000, map[Algorithm]string{AlgorithmSHA1: "69279037", AlgorithmSHA256: "90698825", AlgorithmSHA512: "38618901"}},
+		{20000000000, map[Algorithm]string{AlgorithmSHA1: "65353130", AlgorithmSHA256: "77737706", AlgorithmSHA512: "47863826"}},
+	}
+
+	for _, c := range cases {
+		for algorithm, want := range c.codes {
+			secret := base32.StdEncoding.EncodeToString([]byte(secrets[algorithm]))
+			config := Config{Digits: 8, Algorithm: algorithm}
+			got, err := GenerateCode(secret, time.Unix(c.unix, 0), config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != want {
+				t.Fatalf("%s at %d got %s, want %s", algorithm, c.unix, got, want)
+			}
+		}
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1700000000, 0)
+	code, err := GenerateCode(secret, now.Add(-30*time.Second), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok, _ := Validate(secret, code, now, Config{}); ok {
+		t.Fatal("previous step should fail without skew")
+	}
+
+	step, ok, err := Validate(secret, code, now, Config{Skew: 1})
+	if err != nil || !ok || step != now.Unix()/30-1 {
+		t.Fatalf("previous step should pass with skew, step %d ok %v err %v", step, ok, err)
+	}
+
+	if _, _, err := Validate("not base32!", "123456", now, Config{}); err == nil {
+		t.Fatal("secret wrong should fail")
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := ProvisioningURI("JBSWY3DPEHPK3PXP", "My App", "alice@example.com", Config{})
+	want := "otpauth://totp/My%20App:alice@example.com?algorithm=SHA1&digits=6&issuer=My+App&period=30&secret=JBSWY3DPEHPK3PXP"
+	if uri != want {
+		t.Fatalf("got %s, want %s", uri, want)
+	}
+}
+
+type memoryStore struct {
+	steps    map[string]int64
+	recovery map[string]map[string]bool
+}
+
+func (m *memoryStore) AdvanceStep(userId string, step int64, ttl int64) (bool, error) {
+	if last, ok := m.steps[userId]; ok && step <= last {
+		return false, nil
+	}
+	m.steps[userId] = step
+	return true, nil
+}
+
+func (m *memoryStore) SetRecoveryCodes(userId string, hashes []string) error {
+	m.recovery[userId] = map[string]bool{}
+	for _, h := range hashes {
+		m.recovery[userId][h] = true
+	}
+	return nil
+}
+
+func (m *memoryStore) UseRecoveryCode(userId string, hash string) (bool, error) {
+	if !m.recovery[userId][hash] {
+		return false, nil
+	}
+	delete(m.recovery[userId], hash)
+	return true, nil
+}
+
+func TestManage(t *testing.T) {
+	m, err := NewManage(&memoryStore{steps: map[string]int64{}, recovery: map[string]map[string]bool{}}, Config{Skew: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := GenerateCode(secret, time.Now(), m.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok, err := m.Verify("1", secret, code)
+	if err != nil || !ok {
+		t.Fatalf("first verify ok %v err %v", ok, err)
+	}
+
+	ok, err = m.Verify("1", secret, code)
+	if ok || err != ErrCodeReplay {
+		t.Fatalf("replay verify ok %v err %v", ok, err)
+	}
+
+	codes, err := m.ResetRecoveryCodes("1", 3)
+	if err != nil || len(codes) != 3 {
+		t.Fatalf("recovery codes %v err %v", codes, err)
+	}
+
+	// only hash at rest
+	for _, code := range codes {
+		if m.Store.(*memoryStore).recovery["1"][code] {
+			t.Fatal("recovery code should not store plain")
+		}
+	}
+
+	ok, err = m.UseRecoveryCode("1", strings.ToLower(codes[0]))
+	if err != nil || !ok {
+		t.Fatalf("use recovery code ok %v err %v", ok, err)
+	}
+
+	ok, err = m.UseRecoveryCode("1", codes[0])
+	if err != nil || ok {
+		t.Fatalf("use recovery code again ok %v err %v", ok, err)
+	}
+}
+
+func TestManageRejectEarlierStep(t *testing.T) {
+	m, err := NewManage(&memoryStore{steps: map[string]int64{}, recovery: map[string]map[string]bool{}}, Config{Skew: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	code, err := GenerateCode(secret, now, m.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous, err := GenerateCode(secret, now.Add(-time.Duration(m.Config.Period)*time.Second), m.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok, err := m.Verify("1", secret, code)
+	if err != nil || !ok {
+		t.Fatalf("step N verify ok %v err %v", ok, err)
+	}
+
+	// still in skew window, but step N used
+	ok, err = m.Verify("1", secret, previous)
+	if ok || err != ErrCodeReplay {
+		t.Fatalf("step N-1 after step N verify ok %v err %v", ok, err)
+	}
+
+	// other user not affected
+	ok, err = m.Verify("2", secret, previous)
+	if err != nil || !ok {
+		t.Fatalf("other user verify ok %v err %v", ok, err)
+	}
+}
@@ -0,0 +1,113 @@
+package gosession
+
+import (
+	"fmt"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/hunterhug/gosession/totp"
+)
+
+// redisTOTPStore totp store in the same redis of session
+type redisTOTPStore struct {
+	s *RedisSession
+}
+
+// TOTPStore totp store which record last used time step and recovery code hash in the redis of session
+func (s *RedisSession) TOTPStore() totp.Store {
+	return &redisTOTPStore{s: s}
+}
+
+// save step only when greater than the last one, return 1 when saved
+var totpAdvanceStepScript = redis.NewScript(1, `
+local last = redis.call('GET', KEYS[1])
+if last and tonumber(last) >= tonumber(ARGV[1]) then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[1], 'EX', ARGV[2])
+return 1
+`)
+
+// AdvanceStep compare and set the last step in lua, so only the first one of step and later one success
+func (t *redisTOTPStore) AdvanceStep(userId string, step int64, ttl int64) (ok bool, err error) {
+	if ttl <= 0 {
+		ttl = 1
+	}
+
+	conn := t.s.pool.Get()
+	if conn.Err() != nil {
+		err = conn.Err()
+		return
+	}
+
+	defer func(conn redis.Conn) {
+		err := conn.Close()
+		if err != nil {
+		}
+	}(conn)
+
+	return redis.Bool(totpAdvanceStepScript.Do(conn, t.s.totpStepKey(userId), step, ttl))
+}
+
+// SetRecoveryCodes replace the set of hash
+func (t *redisTOTPStore) SetRecoveryCodes(userId string, hashes []string) (err error) {
+	conn := t.s.pool.Get()
+	if conn.Err() != nil {
+		err = conn.Err()
+		return
+	}
+
+	defer func(conn redis.Conn) {
+		err := conn.Close()
+		if err != nil {
+		}
+	}(conn)
+
+	key := t.s.totpRecoveryKey(userId)
+
+	err = conn.Send("MULTI")
+	if err != nil {
+		return err
+	}
+
+	err = conn.Send("DEL", key)
+	if err != nil {
+		return err
+	}
+
+	if len(hashes) > 0 {
+		err = conn.Send("SADD", redis.Args{}.Add(key).AddFlat(hashes)...)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = conn.Do("EXEC")
+	return err
+}
+
+// UseRecoveryCode SREM, so only the first one success
+func (t *redisTOTPStore) UseRecoveryCode(userId string, hash string) (ok bool, err error) {
+	conn := t.s.pool.Get()
+	if conn.Err() != nil {
+		err = conn.Err()
+		return
+	}
+
+	defer func(conn redis.Conn) {
+		err := conn.Close()
+		if err != nil {
+		}
+	}(conn)
+
+	return redis.Bool(conn.Do("SREM", t.s.totpRecoveryKey(userId), hash))
+}
+
+// key store last used time step of user
+func (s *RedisSession) totpStepKey(userId string) string {
+	return fmt.Sprintf("%s-totp_%s", s.tokenKey, userId)
+}
+
+// set key which store recovery code hash of user
+func (s *RedisSession) totpRecoveryKey(userId string) string {
+	return fmt.Sprintf("%s-totp-recovery_%s", s.tokenKey, userId)
+}
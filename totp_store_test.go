@@ -0,0 +1,30 @@
+package gosession
+
+import (
+	"testing"
+)
+
+func TestTOTPStoreAdvanceStep(t *testing.T) {
+	s := newTestRedisSession(t)
+	store := s.TOTPStore()
+
+	for _, c := range []struct {
+		step int64
+		want bool
+	}{
+		{10, true},
+		{10, false}, // replay
+		{9, false},  // earlier step in skew window
+		{11, true},
+	} {
+		ok, err := store.AdvanceStep("1", c.step, 100)
+		if err != nil || ok != c.want {
+			t.Fatalf("AdvanceStep(%d) = %v %v, want %v", c.step, ok, err, c.want)
+		}
+	}
+
+	// other user has its own last step
+	if ok, err := store.AdvanceStep("2", 9, 100); err != nil || !ok {
+		t.Fatalf("other user AdvanceStep = %v %v", ok, err)
+	}
+}
@@ -0,0 +1,164 @@
+package gosession
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestUserMissMarker(t *testing.T) {
+	if err := decodeUserMiss(encodeUserMiss(nil)); err != nil {
+		t.Fatal("not found should decode nil:", err)
+	}
+
+	if err := decodeUserMiss(encodeUserMiss(errors.New(""))); err == nil {
+		t.Fatal("error with empty message should not read as not found")
+	}
+
+	if err := decodeUserMiss(encodeUserMiss(errors.New("db down"))); err == nil || err.Error() != "db down" {
+		t.Fatal("error message should keep:", err)
+	}
+
+	// written by old version
+	if err := decodeUserMiss([]byte("")); err != nil {
+		t.Fatal("old empty value means not found:", err)
+	}
+	if err := decodeUserMiss([]byte("db down")); err == nil || err.Error() != "db down" {
+		t.Fatal("old value is the error message:", err)
+	}
+}
+
+func TestIsUserSoftExpire(t *testing.T) {
+	s := newRedisSession(nil, tokenKeyDefault, userKeyDefault, 100)
+	if s.isUserSoftExpire(10, 100) {
+		t.Fatal("soft expire disable by default")
+	}
+
+	s.ConfigUserInfoSoftExpireTime(30)
+	if s.isUserSoftExpire(80, 100) {
+		t.Fatal("live 20 second not soft expire")
+	}
+	if !s.isUserSoftExpire(70, 100) {
+		t.Fatal("live 30 second should soft expire")
+	}
+
+	// default valid time same as set
+	if !s.isUserSoftExpire(60, 0) {
+		t.Fatal("live 40 second of default 100 should soft expire")
+	}
+}
+
+func TestUserSoftExpireReload(t *testing.T) {
+	s := newTestRedisSession(t)
+
+	var loads int64
+	s.ConfigGetUserInfoFunc(func(id string) (*User, error) {
+		return &User{Detail: fmt.Sprintf("load %d", atomic.AddInt64(&loads, 1))}, nil
+	})
+	s.ConfigUserInfoSoftExpireTime(1)
+
+	token, err := s.SetToken("1", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, exist, err := s.CheckTokenOrUpdateUser(token, 100)
+	if err != nil || !exist || user.Detail != "load 1" {
+		t.Fatalf("first check should load: %+v %v %v", user, exist, err)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+
+	// old one return, reload in background
+	user, _, _ = s.CheckTokenOrUpdateUser(token, 100)
+	if user.Detail != "load 1" {
+		t.Fatalf("soft expire should return old one: %+v", user)
+	}
+
+	for i := 0; i < 50 && atomic.LoadInt64(&loads) < 2; i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	user, _, _ = s.CheckTokenOrUpdateUser(token, 100)
+	if user.Detail != "load 2" {
+		t.Fatalf("background reload should update cache: %+v", user)
+	}
+}
+
+func TestUserNegativeCache(t *testing.T) {
+	s := newTestRedisSession(t)
+
+	var loads int64
+	loadErr := fmt.Errorf("wrap: %w", ErrUserNotFound)
+	s.ConfigGetUserInfoFunc(func(id string) (*User, error) {
+		atomic.AddInt64(&loads, 1)
+		return nil, loadErr
+	})
+	s.ConfigUserInfoNegativeExpireTime(100)
+
+	token, err := s.SetToken("1", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		_, exist, err := s.CheckTokenOrUpdateUser(token, 100)
+		if err != nil || exist {
+			t.Fatalf("wrapped not found should report not exist: %v %v", exist, err)
+		}
+	}
+
+	if n := atomic.LoadInt64(&loads); n != 1 {
+		t.Fatalf("not found should cache, load %d times", n)
+	}
+
+	// load error with empty message still an error
+	loadErr = errors.New("")
+	_ = s.DeleteUser("2")
+	token2, _ := s.SetToken("2", 100)
+	for i := 0; i < 2; i++ {
+		if _, _, err := s.CheckTokenOrUpdateUser(token2, 100); err == nil {
+			t.Fatal("load error should return error, even cached")
+		}
+	}
+
+	if n := atomic.LoadInt64(&loads); n != 2 {
+		t.Fatalf("load error should cache, load %d times", n)
+	}
+}
+
+func TestLoadUserNegativeCacheTwice(t *testing.T) {
+	s := newTestRedisSession(t)
+
+	var loads int64
+	loadErr := ErrUserNotFound
+	s.ConfigGetUserInfoFunc(func(id string) (*User, error) {
+		atomic.AddInt64(&loads, 1)
+		return nil, loadErr
+	})
+	s.ConfigUserInfoNegativeExpireTime(100)
+
+	// second one read the miss key, not found still not exist and no error
+	for i := 0; i < 2; i++ {
+		user, exist, err := s.loadUser("1", s.hashUserKey("1"), 100)
+		if err != nil || exist || user != nil {
+			t.Fatalf("load missing user %d: %+v %v %v", i, user, exist, err)
+		}
+	}
+
+	// cached load error keep the message, no marker prefix
+	loadErr = errors.New("db down")
+	for i := 0; i < 2; i++ {
+		_, exist, err := s.loadUser("2", s.hashUserKey("2"), 100)
+		if exist || err == nil || err.Error() != "db down" {
+			t.Fatalf("load fail user %d: %v %v", i, exist, err)
+		}
+	}
+
+	if n := atomic.LoadInt64(&loads); n != 2 {
+		t.Fatalf("miss should cache, load %d times", n)
+	}
+}